@@ -1,11 +1,9 @@
 package polishedqr
 
-import "image"
-
-func drawAlignmentPatterns(i *image.RGBA) {
-	version := (i.Rect.Dx()-21)/4 + 1
+func drawAlignmentPatterns(s *Symbol) {
+	version := (s.Width()-21)/4 + 1
 	for _, v := range getAlignmentPositions(version) {
-		drawAlignmentPattern(i, v[0]-2, v[1]-2)
+		drawAlignmentPattern(s, v[0]-2, v[1]-2)
 	}
 }
 
@@ -0,0 +1,344 @@
+package polishedqr
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A way of splitting an image into dark and light pixels
+type Binarizer int
+
+const (
+	// Threshold the whole image halfway between the darkest and lightest pixels
+	GlobalBinarizer Binarizer = iota
+
+	// Threshold blocks of 8x8 pixels using the black points of the blocks around them,
+	// like zxing's HybridBinarizer. Good for shadows and gradients
+	HybridBinarizer
+
+	// Compare each pixel with the mean of the pixels around it
+	MeanBinarizer
+
+	// Sauvola's method, which lowers the local threshold where there is little contrast,
+	// so flat areas stay light
+	SauvolaBinarizer
+)
+
+// The binarizers that are tried when none are given, in order
+var defaultBinarizers = []Binarizer{GlobalBinarizer, HybridBinarizer, MeanBinarizer, SauvolaBinarizer}
+
+func (m Binarizer) String() string {
+	switch m {
+	case GlobalBinarizer:
+		return "global"
+	case HybridBinarizer:
+		return "hybrid"
+	case MeanBinarizer:
+		return "mean"
+	case SauvolaBinarizer:
+		return "sauvola"
+	}
+
+	return "unknown"
+}
+
+// A grayscale copy of an image
+type grayImage struct {
+	width  int
+	height int
+	pix    []uint8
+
+	// The darkest and lightest pixels
+	min uint8
+	max uint8
+}
+
+// An image that has been thresholded into dark and light pixels
+type bitmap struct {
+	width  int
+	height int
+	dark   []bool
+
+	// The grey level of each pixel, and the level that each pixel was split at
+	gray      []uint8
+	threshold []int16
+	contrast  int
+}
+
+// Convert an image into grayscale
+func toGray(img image.Image) *grayImage {
+	r := img.Bounds()
+	g := &grayImage{width: r.Dx(), height: r.Dy(), pix: make([]uint8, r.Dx()*r.Dy()), min: 255}
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			v := color.GrayModel.Convert(img.At(r.Min.X+x, r.Min.Y+y)).(color.Gray).Y
+			g.pix[y*r.Dx()+x] = v
+
+			if v < g.min {
+				g.min = v
+			}
+			if v > g.max {
+				g.max = v
+			}
+		}
+	}
+
+	return g
+}
+
+// Returns a copy of the image resized to width x height. Each pixel is the average of the pixels it covers,
+// or the nearest pixel when scaling up
+func (g *grayImage) scaled(width, height int) *grayImage {
+	out := &grayImage{width: width, height: height, pix: make([]uint8, width*height), min: 255}
+	fx, fy := float64(g.width)/float64(width), float64(g.height)/float64(height)
+	for y := 0; y < height; y++ {
+		y0 := int(float64(y) * fy)
+		y1 := int(math.Max(float64(y0+1), float64(int(float64(y+1)*fy))))
+		for x := 0; x < width; x++ {
+			x0 := int(float64(x) * fx)
+			x1 := int(math.Max(float64(x0+1), float64(int(float64(x+1)*fx))))
+
+			var sum, count int
+			for sy := y0; sy < y1 && sy < g.height; sy++ {
+				for sx := x0; sx < x1 && sx < g.width; sx++ {
+					sum += int(g.pix[sy*g.width+sx])
+					count++
+				}
+			}
+
+			v := uint8(sum / count)
+			out.pix[y*width+x] = v
+			if v < out.min {
+				out.min = v
+			}
+			if v > out.max {
+				out.max = v
+			}
+		}
+	}
+
+	return out
+}
+
+// Split the image into dark and light pixels. Pixels at or below their threshold are dark
+func (g *grayImage) binarize(method Binarizer) *bitmap {
+	b := &bitmap{
+		width:     g.width,
+		height:    g.height,
+		dark:      make([]bool, len(g.pix)),
+		gray:      g.pix,
+		threshold: make([]int16, len(g.pix)),
+		contrast:  int(g.max) - int(g.min),
+	}
+
+	switch method {
+	case HybridBinarizer:
+		g.hybridThresholds(b.threshold)
+	case MeanBinarizer, SauvolaBinarizer:
+		g.localThresholds(b.threshold, method == SauvolaBinarizer)
+	default:
+		threshold := (int16(g.min) + int16(g.max)) / 2
+		if g.min == g.max {
+			// There is nothing to find in a blank image
+			threshold = -1
+		}
+
+		for k := range b.threshold {
+			b.threshold[k] = threshold
+		}
+	}
+
+	for k, v := range g.pix {
+		b.dark[k] = int16(v) <= b.threshold[k]
+	}
+
+	return b
+}
+
+// Blocks with less contrast than this are assumed to be all light or all dark
+const hybridMinDynamicRange = 24
+
+// Find the black point of every 8x8 block, then threshold each block at the average black point of the 5x5 blocks around it
+func (g *grayImage) hybridThresholds(thresholds []int16) {
+	blocksX := (g.width + 7) / 8
+	blocksY := (g.height + 7) / 8
+	if blocksX < 5 || blocksY < 5 {
+		// Too small to have blocks around each block, so use the whole image instead
+		g.localThresholds(thresholds, false)
+		return
+	}
+
+	blackPoints := make([]int, blocksX*blocksY)
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			sum, count := 0, 0
+			min, max := 255, 0
+			for y := by * 8; y < by*8+8 && y < g.height; y++ {
+				for x := bx * 8; x < bx*8+8 && x < g.width; x++ {
+					v := int(g.pix[y*g.width+x])
+					sum += v
+					count++
+					if v < min {
+						min = v
+					}
+					if v > max {
+						max = v
+					}
+				}
+			}
+
+			average := sum / count
+			if max-min <= hybridMinDynamicRange {
+				// A flat block is assumed to be light, unless the blocks before it say otherwise
+				average = min / 2
+				if bx > 0 && by > 0 {
+					neighbours := (blackPoints[(by-1)*blocksX+bx] + 2*blackPoints[by*blocksX+bx-1] + blackPoints[(by-1)*blocksX+bx-1]) / 4
+					if min < neighbours {
+						average = neighbours
+					}
+				}
+			}
+
+			blackPoints[by*blocksX+bx] = average
+		}
+	}
+
+	clamp := func(v, low, high int) int {
+		return int(math.Max(float64(low), math.Min(float64(high), float64(v))))
+	}
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			// Average the black points of the 5x5 blocks around this one, staying inside the image
+			cx := clamp(bx, 2, blocksX-3)
+			cy := clamp(by, 2, blocksY-3)
+			var sum int
+			for y := cy - 2; y <= cy+2; y++ {
+				for x := cx - 2; x <= cx+2; x++ {
+					sum += blackPoints[y*blocksX+x]
+				}
+			}
+
+			threshold := int16(sum / 25)
+			for y := by * 8; y < by*8+8 && y < g.height; y++ {
+				for x := bx * 8; x < bx*8+8 && x < g.width; x++ {
+					thresholds[y*g.width+x] = threshold
+				}
+			}
+		}
+	}
+}
+
+// How far below the local mean a pixel has to be to be dark, as a fraction of the mean
+const meanBias = 0.1
+
+// The weight of the standard deviation in Sauvola's method, and the largest standard deviation there can be
+const (
+	sauvolaK = 0.2
+	sauvolaR = 128
+)
+
+// Threshold each pixel by the pixels in a window around it, which is big enough to cover a finder pattern
+// in most images. Uses Sauvola's method if sauvola is set, otherwise the mean of the window
+func (g *grayImage) localThresholds(thresholds []int16, sauvola bool) {
+	radius := int(math.Max(8, math.Max(float64(g.width), float64(g.height))/16))
+
+	// Integral images of the pixels and their squares, with an extra row and column of zeros
+	w := g.width + 1
+	sums := make([]float64, w*(g.height+1))
+	squares := make([]float64, w*(g.height+1))
+	for y := 0; y < g.height; y++ {
+		var rowSum, rowSquares float64
+		for x := 0; x < g.width; x++ {
+			v := float64(g.pix[y*g.width+x])
+			rowSum += v
+			rowSquares += v * v
+			sums[(y+1)*w+x+1] = sums[y*w+x+1] + rowSum
+			squares[(y+1)*w+x+1] = squares[y*w+x+1] + rowSquares
+		}
+	}
+
+	area := func(table []float64, x0, y0, x1, y1 int) float64 {
+		return table[y1*w+x1] - table[y0*w+x1] - table[y1*w+x0] + table[y0*w+x0]
+	}
+
+	// Returns the start and end of the window around v, staying inside the image
+	window := func(v, size int) (int, int) {
+		start, end := v-radius, v+radius+1
+		if start < 0 {
+			start = 0
+		}
+		if end > size {
+			end = size
+		}
+		return start, end
+	}
+
+	for y := 0; y < g.height; y++ {
+		y0, y1 := window(y, g.height)
+		for x := 0; x < g.width; x++ {
+			x0, x1 := window(x, g.width)
+			n := float64((x1 - x0) * (y1 - y0))
+			mean := area(sums, x0, y0, x1, y1) / n
+
+			var threshold float64
+			if sauvola {
+				deviation := math.Sqrt(math.Max(0, area(squares, x0, y0, x1, y1)/n-mean*mean))
+				threshold = mean * (1 + sauvolaK*(deviation/sauvolaR-1))
+			} else {
+				threshold = mean * (1 - meanBias)
+			}
+
+			thresholds[y*g.width+x] = int16(math.Floor(threshold))
+		}
+	}
+}
+
+// Returns a copy of the bitmap with dark and light swapped, for reading light codes on dark backgrounds
+func (b *bitmap) inverted() *bitmap {
+	inv := *b
+	inv.dark = make([]bool, len(b.dark))
+	for k, v := range b.dark {
+		inv.dark[k] = !v
+	}
+
+	return &inv
+}
+
+// Returns true if the pixel is dark. Pixels outside of the image are light
+func (b *bitmap) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.width || y >= b.height {
+		return false
+	}
+
+	return b.dark[y*b.width+x]
+}
+
+// Returns true if the pixel containing the point is dark
+func (b *bitmap) atPoint(p point) bool {
+	return b.at(int(math.Floor(p.x)), int(math.Floor(p.y)))
+}
+
+// Returns how far the pixel containing the point is from its threshold, from 0 (right on it)
+// to 1 (as dark or as light as the image gets). Pixels outside of the image are certainly light
+func (b *bitmap) marginAt(p point) float64 {
+	x, y := int(math.Floor(p.x)), int(math.Floor(p.y))
+	if x < 0 || y < 0 || x >= b.width || y >= b.height || b.contrast == 0 {
+		return 1
+	}
+
+	k := y*b.width + x
+	return math.Min(1, math.Abs(float64(int16(b.gray[k])-b.threshold[k]))*2/float64(b.contrast))
+}
+
+// Returns the reflectance of the pixel containing the point, from 0 (black) to 1 (white),
+// or false if it is outside of the image
+func (b *bitmap) reflectanceAt(p point) (float64, bool) {
+	x, y := int(math.Floor(p.x)), int(math.Floor(p.y))
+	if x < 0 || y < 0 || x >= b.width || y >= b.height {
+		return 0, false
+	}
+
+	return float64(b.gray[y*b.width+x]) / 255, true
+}
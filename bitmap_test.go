@@ -0,0 +1,55 @@
+package polishedqr
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Darken an image from its top left corner down to a fraction of the light in its bottom right,
+// like a code lit from one side. The contrast drops along with the light
+func unevenlyLit(img *image.RGBA, darkest float64) *image.RGBA {
+	out := image.NewRGBA(img.Rect)
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			light := 1 - (1-darkest)*float64(x+y)/float64(w+h)
+			v := uint8((float64(img.RGBAAt(x, y).R)*0.8 + 20) * light)
+			out.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	return out
+}
+
+// Read evenly and unevenly lit codes with each binarizer on its own
+func TestBinarizers(t *testing.T) {
+	data := "unevenly lit"
+	img := testImages(t, []string{data}, 4)[0]
+	uneven := unevenlyLit(img, 0.2)
+
+	for _, b := range defaultBinarizers {
+		t.Run(b.String(), func(t *testing.T) {
+			opts := &ReadOptions{Binarizers: []Binarizer{b}}
+			result, err := ReadFromImage(img, opts)
+			if err != nil || string(result.Data) != data {
+				t.Fatalf("read %q and %v from an evenly lit code, expected %q", result.Data, err, data)
+			}
+
+			// The global threshold is too dark for one side and too light for the other
+			result, err = ReadFromImage(uneven, opts)
+			if b == GlobalBinarizer {
+				if err == nil {
+					t.Errorf("read the unevenly lit code with one threshold, expected it to need a local one")
+				}
+			} else if err != nil || string(result.Data) != data {
+				t.Errorf("read %q and %v from an unevenly lit code, expected %q", result.Data, err, data)
+			}
+		})
+	}
+
+	// The default binarizers fall back to the local ones
+	if result, err := ReadFromImage(uneven, nil); err != nil || string(result.Data) != data {
+		t.Errorf("read %q and %v from an unevenly lit code with the default binarizers, expected %q", result.Data, err, data)
+	}
+}
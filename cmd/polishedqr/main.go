@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/superkooks/polishedqr"
 	"github.com/urfave/cli/v2"
-	"gocv.io/x/gocv"
 
-	"image/draw"
 	_ "image/jpeg"
 	"image/png"
 )
@@ -32,12 +33,119 @@ func writeOut(outPath string, data io.Reader) {
 	}
 }
 
+// Render a symbol scaled by a factor, which doesn't have to be a whole number
+func renderScaled(symbol *polishedqr.Symbol, scale float64) *image.RGBA {
+	if scale == math.Trunc(scale) {
+		return symbol.Render(int(scale))
+	}
+
+	// Scale up the image with a pixel per module, using the nearest pixel
+	src := symbol.Render(1)
+	r := image.Rect(0, 0, int(float64(src.Rect.Dx())*scale), int(float64(src.Rect.Dy())*scale))
+	img := image.NewRGBA(r)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			img.Set(x, y, src.At(int(float64(x)/scale), int(float64(y)/scale)))
+		}
+	}
+
+	return img
+}
+
+// Returns the read options from the flags of a command
+func readOptions(ctx *cli.Context) *polishedqr.ReadOptions {
+	binarizers := map[string]polishedqr.Binarizer{
+		"global":  polishedqr.GlobalBinarizer,
+		"hybrid":  polishedqr.HybridBinarizer,
+		"mean":    polishedqr.MeanBinarizer,
+		"sauvola": polishedqr.SauvolaBinarizer,
+	}
+
+	opts := &polishedqr.ReadOptions{}
+	for _, v := range ctx.StringSlice("binarizer") {
+		b, ok := binarizers[strings.ToLower(v)]
+		if !ok {
+			panic(fmt.Errorf("unknown binarizer %v", v))
+		}
+		opts.Binarizers = append(opts.Binarizers, b)
+	}
+
+	opts.TryHarder = ctx.Bool("try-harder")
+	opts.Pure = ctx.Bool("pure")
+	if ctx.IsSet("eci") {
+		eci := ctx.Int("eci")
+		opts.ECI = &eci
+	}
+
+	return opts
+}
+
+// Save the images of each step of reading an image into dir, as png files
+func writeDebugImages(dir string, info *polishedqr.DebugInfo) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	save := func(name string, img image.Image) {
+		if img == nil {
+			return
+		}
+
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		err = png.Encode(f, img)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	save("binarized.png", info.Binarized)
+	save("candidates.png", info.Candidates)
+	for k, v := range info.Symbols {
+		save(fmt.Sprintf("symbol%v_grid.png", k), v.Grid)
+		save(fmt.Sprintf("symbol%v_modules.png", k), v.Modules)
+	}
+}
+
+// Micro qr code versions are written as M1 to M4
+func formatVersion(result polishedqr.QRCodeResult) string {
+	if result.Micro {
+		return fmt.Sprintf("M%v", result.Version)
+	}
+
+	return fmt.Sprint(result.Version)
+}
+
+// Notes how the code appeared in the image, if it wasn't read normally
+func formatAppearance(result polishedqr.QRCodeResult) string {
+	var notes []string
+	if result.Inverted {
+		notes = append(notes, "inverted")
+	}
+	if result.Mirrored {
+		notes = append(notes, "mirrored")
+	}
+
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// Commands from files that need build tags
+var extraCommands []*cli.Command
+
 func main() {
 	app := &cli.App{
 		Name:  "polishedqr",
 		Usage: "create and read qr codes",
 		Flags: []cli.Flag{cli.BashCompletionFlag},
-		Commands: []*cli.Command{
+		Commands: append([]*cli.Command{
 			{
 				Name:      "create",
 				Aliases:   []string{"c"},
@@ -56,12 +164,28 @@ func main() {
 					&cli.StringFlag{
 						Name:        "ec",
 						Usage:       "the error correction level to use (one of L, M, Q, H)",
-						DefaultText: "M",
-						Value:       "M",
+						DefaultText: "M, or L for micro qr codes that fit in M1",
+					},
+					&cli.BoolFlag{
+						Name:  "gs1",
+						Usage: "encode the input as gs1 data, such as (01)09501101530008(17)260101",
+					},
+					&cli.BoolFlag{
+						Name:  "micro",
+						Usage: "create a micro qr code (versions 1 to 4 are M1 to M4)",
+					},
+					&cli.BoolFlag{
+						Name:  "rmqr",
+						Usage: "create a rectangular micro qr code (versions 1 to 32 are R7x43 to R17x139)",
+					},
+					&cli.IntFlag{
+						Name:        "max-height",
+						Usage:       "the maximum height of a rectangular micro qr code, in modules",
+						DefaultText: "0 (any)",
 					},
 					&cli.Float64Flag{
 						Name:        "scale",
-						Usage:       "the factor to scale the output image by",
+						Usage:       "the factor to scale the output image by, which is the width of each module in pixels",
 						DefaultText: "1",
 						Value:       1,
 					},
@@ -92,30 +216,22 @@ func main() {
 					opts := &polishedqr.CreateOptions{
 						ErrorCorrectionLevel: ctx.String("ec"),
 						Version:              ctx.Int("version"),
+						GS1:                  ctx.Bool("gs1"),
+						MaxHeight:            ctx.Int("max-height"),
 					}
-					img := polishedqr.CreateQRCode(b, opts)
-
-					if ctx.Float64("scale") != 1 {
-						mat, err := gocv.ImageToMatRGBA(img)
-						if err != nil {
-							panic(err)
-						}
-						gocv.Resize(mat, &mat, image.Pt(0, 0), ctx.Float64("scale"), ctx.Float64("scale"), gocv.InterpolationNearestNeighbor)
-
-						i, err := mat.ToImage()
-						if err != nil {
-							panic(err)
-						}
-
-						r := image.Rect(
-							0, 0,
-							int(float64(img.Rect.Dx())*ctx.Float64("scale")),
-							int(float64(img.Rect.Dy())*ctx.Float64("scale")),
-						)
 
-						img = image.NewRGBA(r)
-						draw.Draw(img, r, i, image.Pt(0, 0), draw.Over)
+					var symbol *polishedqr.Symbol
+					if ctx.Bool("micro") {
+						symbol, err = polishedqr.CreateMicro(b, opts)
+					} else if ctx.Bool("rmqr") {
+						symbol, err = polishedqr.CreateRMQR(b, opts)
+					} else {
+						symbol, err = polishedqr.Create(b, opts)
+					}
+					if err != nil {
+						return fmt.Errorf("error creating qr code: %v", err)
 					}
+					img := renderScaled(symbol, ctx.Float64("scale"))
 
 					if ctx.Path("out") == "" {
 						PrintQRCodeASCII(img)
@@ -144,6 +260,32 @@ func main() {
 						Name:  "out",
 						Usage: "the path to save the decoded data",
 					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "read every code in the image, saving their data on separate lines",
+					},
+					&cli.StringSliceFlag{
+						Name:        "binarizer",
+						Usage:       "the ways to split the image into dark and light, tried in order (global, hybrid, mean or sauvola)",
+						DefaultText: "all of them",
+					},
+					&cli.BoolFlag{
+						Name:  "try-harder",
+						Usage: "also read the image at half and double its size if no code is found",
+					},
+					&cli.BoolFlag{
+						Name:  "pure",
+						Usage: "the image is just a code that isn't skewed, such as one made by create",
+					},
+					&cli.IntFlag{
+						Name:        "eci",
+						Usage:       "the eci assignment to assume for data without one, such as 20 for shift jis",
+						DefaultText: "none",
+					},
+					&cli.PathFlag{
+						Name:  "debug-dir",
+						Usage: "the directory to save images of each step of reading the image into",
+					},
 				},
 
 				Action: func(ctx *cli.Context) error {
@@ -168,22 +310,46 @@ func main() {
 						panic(err)
 					}
 
-					var rgba *image.RGBA
-					var ok bool
-					if rgba, ok = i.(*image.RGBA); !ok {
-						rgba = image.NewRGBA(i.Bounds())
-						draw.Draw(rgba, i.Bounds(), i, i.Bounds().Min, draw.Src)
+					opts := readOptions(ctx)
+					if ctx.Path("debug-dir") != "" {
+						opts.Debug = &polishedqr.DebugInfo{}
+						defer writeDebugImages(ctx.Path("debug-dir"), opts.Debug)
+					}
+
+					if ctx.Bool("all") {
+						results, err := polishedqr.ReadAllFromImage(i, opts)
+						if err != nil {
+							panic(fmt.Errorf("error decoding qr codes: %v", err))
+						}
+
+						var data [][]byte
+						for _, result := range results {
+							fmt.Printf(
+								"detected version %v code with error correction %v at %v%v\n",
+								formatVersion(result),
+								result.ErrorCorrectionLevel,
+								result.Location.Center,
+								formatAppearance(result),
+							)
+							data = append(data, result.Data)
+						}
+						fmt.Println()
+
+						writeOut(ctx.Path("out"), bytes.NewBuffer(bytes.Join(data, []byte("\n"))))
+
+						return nil
 					}
 
-					result, err := polishedqr.ReadFromImage(rgba)
+					result, err := polishedqr.ReadFromImage(i, opts)
 					if err != nil {
 						panic(fmt.Errorf("error decoding qr code: %v", err))
 					}
 
 					fmt.Printf(
-						"detected version %v code with error correction %v\n\n",
-						result.Version,
+						"detected version %v code with error correction %v%v\n\n",
+						formatVersion(result),
 						result.ErrorCorrectionLevel,
+						formatAppearance(result),
 					)
 
 					writeOut(ctx.Path("out"), bytes.NewBuffer(result.Data))
@@ -192,28 +358,64 @@ func main() {
 				},
 			},
 			{
-				Name:      "webcam",
-				Aliases:   []string{"w"},
-				Usage:     "read a qr code from the webcam",
-				ArgsUsage: " ",
+				Name:      "grade",
+				Aliases:   []string{"g"},
+				Usage:     "grade the print quality of a qr code in a scanned image",
+				ArgsUsage: "image",
+
 				Action: func(ctx *cli.Context) error {
-					result, err := polishedqr.ReadFromWebcam(true)
+					inPath := ctx.Args().First()
+					if inPath == "" {
+						panic("no file input")
+					}
+
+					var inReader io.Reader
+					if inPath == "-" {
+						inReader = os.Stdin
+					} else {
+						var err error
+						inReader, err = os.Open(inPath)
+						if err != nil {
+							panic(err)
+						}
+					}
+
+					i, _, err := image.Decode(inReader)
 					if err != nil {
 						panic(err)
 					}
 
+					report, err := polishedqr.Grade(i)
+					if err != nil {
+						panic(fmt.Errorf("error grading qr code: %v", err))
+					}
+
 					fmt.Printf(
-						"detected version %v code with error correction %v\n\n",
-						result.Version,
-						result.ErrorCorrectionLevel,
+						"graded version %v code with error correction %v\n\n",
+						formatVersion(report.Result),
+						report.Result.ErrorCorrectionLevel,
 					)
 
-					writeOut(ctx.Path("out"), bytes.NewBuffer(result.Data))
+					for _, v := range []struct {
+						name  string
+						value polishedqr.GradedValue
+					}{
+						{"symbol contrast", report.SymbolContrast},
+						{"modulation", report.Modulation},
+						{"reflectance margin", report.ReflectanceMargin},
+						{"fixed pattern damage", report.FixedPatternDamage},
+						{"axial non-uniformity", report.AxialNonUniformity},
+						{"grid non-uniformity", report.GridNonUniformity},
+						{"unused error correction", report.UnusedErrorCorrection},
+					} {
+						fmt.Printf("%-24v %6.2f  %v\n", v.name, v.value.Value, v.value.Grade)
+					}
+					fmt.Printf("\noverall grade %v\n", report.Overall)
 
 					return nil
 				},
 			},
-		},
+		}, extraCommands...),
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,120 @@
+//go:build gocv
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/superkooks/polishedqr"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	extraCommands = append(extraCommands, &cli.Command{
+		Name:      "webcam",
+		Aliases:   []string{"w"},
+		Usage:     "read a qr code from the webcam",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.PathFlag{
+				Name:  "out",
+				Usage: "the path to save the decoded data",
+			},
+			&cli.IntFlag{
+				Name:        "device",
+				Usage:       "the index of the camera to read from",
+				DefaultText: "0",
+			},
+			&cli.Float64Flag{
+				Name:        "fps",
+				Usage:       "the frame rate to ask the camera for",
+				DefaultText: "30",
+			},
+			&cli.DurationFlag{
+				Name:        "timeout",
+				Usage:       "how long to wait for a code before giving up",
+				DefaultText: "forever",
+			},
+			&cli.BoolFlag{
+				Name:  "display",
+				Usage: "show the camera and the steps of reading it in windows, use --display=false to run without a screen",
+				Value: true,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			opts := readOptions(ctx)
+			opts.Device = ctx.Int("device")
+			opts.FrameRate = ctx.Float64("fps")
+
+			c := context.Background()
+			if ctx.Duration("timeout") > 0 {
+				var cancel context.CancelFunc
+				c, cancel = context.WithTimeout(c, ctx.Duration("timeout"))
+				defer cancel()
+			}
+
+			result, err := polishedqr.ReadFromWebcamContext(c, opts, ctx.Bool("display"))
+			if err != nil {
+				return fmt.Errorf("error reading from webcam: %v", err)
+			}
+
+			fmt.Printf(
+				"detected version %v code with error correction %v\n\n",
+				formatVersion(result),
+				result.ErrorCorrectionLevel,
+			)
+
+			writeOut(ctx.Path("out"), bytes.NewBuffer(result.Data))
+
+			return nil
+		},
+	})
+
+	extraCommands = append(extraCommands, &cli.Command{
+		Name:      "scan",
+		Aliases:   []string{"s"},
+		Usage:     "keep reading qr codes from the webcam or a video, printing each new one on its own line",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.PathFlag{
+				Name:  "video",
+				Usage: "read the frames of a video file instead of the webcam",
+			},
+			&cli.IntFlag{
+				Name:        "device",
+				Usage:       "the index of the camera to read from",
+				DefaultText: "0",
+			},
+			&cli.DurationFlag{
+				Name:        "cooldown",
+				Usage:       "how long a code has to be out of sight before it is printed again",
+				DefaultText: "2s",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			opts := readOptions(ctx)
+			opts.Device = ctx.Int("device")
+			opts.Cooldown = ctx.Duration("cooldown")
+
+			var scanner *polishedqr.Scanner
+			var err error
+			if ctx.Path("video") != "" {
+				scanner, err = polishedqr.NewVideoScanner(ctx.Path("video"), opts)
+			} else {
+				scanner, err = polishedqr.NewScanner(opts)
+			}
+			if err != nil {
+				return fmt.Errorf("error starting scanner: %v", err)
+			}
+			defer scanner.Close()
+
+			for result := range scanner.Results() {
+				fmt.Printf("%s\n", result.Data)
+			}
+
+			return scanner.Err()
+		},
+	})
+}
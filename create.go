@@ -1,6 +1,7 @@
 package polishedqr
 
 import (
+	"fmt"
 	"image"
 )
 
@@ -10,36 +11,81 @@ type CreateOptions struct {
 	// "M": recover 15%
 	// "Q": recover 25%
 	// "H": recover 30%
-	// If unset, defaults to "M"
+	// If unset, defaults to "M", except for micro qr codes small enough for M1, which only detect errors
 	ErrorCorrectionLevel string
 
 	// The character set to encode the data with.
-	// If unset, the character set will be chosen automatically,
-	// however, encoding formats will not be mixed on the same code.
+	// If unset, the data will be split into segments of different character sets,
+	// choosing the split that results in the smallest code.
 	CharacterSet *CharacterSet
 
+	// Encode all of the data with a single character set, rather than mixing
+	// character sets on the same code. If CharacterSet is unset, it will be chosen automatically.
+	DisableSegmentation bool
+
+	// The ECI assignment to mark the data with, such as ECIUTF8.
+	// Byte segments are converted from utf-8 into the charset of the assignment, if it is known.
+	// If unset, utf-8 (ECI 26) will be used if the data contains utf-8 characters that aren't ascii.
+	ECI *int
+
+	// Encode the data as GS1, using FNC1 in the first position.
+	// Data should be given as bracketed application identifiers and their values,
+	// such as (01)09501101530008(17)260101
+	GS1 bool
+
 	// The version (size) of the qr code.
 	// If unset, the version will be the smallest that can fit the data
 	Version int
+
+	// The maximum height of rmqr codes, in modules (from 7 to 17).
+	// The width is chosen to fit the data. If unset, any height can be used
+	MaxHeight int
 }
 
 // Create a qr code from data with options, which may be nil.
-// Data that is numeric or alphanumeric should be passed in their ascii form
+// Data that is numeric or alphanumeric should be passed in their ascii form,
+// and kanji should be passed as utf-8
+func Create(data []byte, opts *CreateOptions) (*Symbol, error) {
+	if opts != nil && opts.GS1 {
+		var err error
+		data, err = parseGS1Input(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return createQRCode(data, opts, nil)
+}
+
+// Like Create, but panics if the code can't be created
 func CreateQRCode(data []byte, opts *CreateOptions) *image.RGBA {
-	if opts == nil {
-		opts = &CreateOptions{}
+	s, err := Create(data, opts)
+	if err != nil {
+		panic(err)
 	}
 
-	if opts.ErrorCorrectionLevel == "" {
-		opts.ErrorCorrectionLevel = "M"
+	return s.Render(1)
+}
+
+// Returns an error if the options can't be used to create a qr code
+func checkOptions(opts *CreateOptions) error {
+	if _, ok := codeWordTable[1][opts.ErrorCorrectionLevel]; !ok {
+		return fmt.Errorf("%w %q", ErrInvalidECLevel, opts.ErrorCorrectionLevel)
 	}
 
-	// Encode data in correct mode
-	var mode CharacterSet
-	if opts.CharacterSet != nil {
-		mode = *opts.CharacterSet
-	} else {
-		mode = AutodetectCharacterSet(data)
+	if opts.Version < 0 || opts.Version > 40 {
+		return fmt.Errorf("%w: qr codes are from version 1 to 40, not %v", ErrInvalidVersion, opts.Version)
+	}
+
+	return nil
+}
+
+// Encode data into bits, after the header bits, choosing the smallest version
+// that fits if it is unset. Returns the bits, the version and the number of datawords it holds.
+// GS1 data must already be converted into an element string.
+func encodeData(data []byte, opts *CreateOptions, header Bits) (Bits, int, int, error) {
+	if err := checkOptions(opts); err != nil {
+		return nil, 0, 0, err
 	}
 
 	var version int
@@ -50,23 +96,26 @@ func CreateQRCode(data []byte, opts *CreateOptions) *image.RGBA {
 		version = opts.Version
 	}
 
-	var dataBits Bits
-	var totalDatawords int
+	var segments []segment
 	for {
 		// Encode data
-		switch mode {
-		case Numeric:
-			dataBits = ConvertToNumeric(data, version)
-		case Alphanumeric:
-			dataBits = ConvertToAlphanumeric(data, version)
-		case Bytes:
-			dataBits = ConvertToBytes(data, version)
-		default:
-			panic("unsupported encoding mode")
+		if opts.CharacterSet != nil {
+			segments = []segment{{mode: *opts.CharacterSet, data: data}}
+		} else if opts.DisableSegmentation {
+			segments = []segment{{mode: AutodetectCharacterSet(data), data: data}}
+		} else if segments == nil || version == 10 || version == 27 {
+			// The best split depends on the size of the character counts,
+			// so we have to segment again whenever they change
+			segments = segmentData(data, qrDataFormat(version), opts.GS1)
+		}
+
+		dataBits, err := encodeDataSegments(segments, opts, qrDataFormat(version), header)
+		if err != nil {
+			return nil, 0, 0, err
 		}
 
 		// Get total data size of this symbol
-		totalDatawords = 0
+		totalDatawords := 0
 		blocks := codeWordTable[version][opts.ErrorCorrectionLevel]
 		for _, v := range blocks.blocks {
 			totalDatawords += v.dataWords * v.count
@@ -74,29 +123,142 @@ func CreateQRCode(data []byte, opts *CreateOptions) *image.RGBA {
 
 		// Check whether the data fits
 		if len(dataBits) > totalDatawords*8 {
-			if version != opts.Version {
+			if version != opts.Version && version != 40 {
 				// Version is unset in options, try a larger symbol size
-				if version == 40 {
-					panic("data cannot fit in largest qr code")
-				}
-
 				version++
 				continue
-			} else {
-				panic("data cannot fit in designated size qr code")
+			}
+
+			return nil, 0, 0, &DataTooLargeError{
+				Required:  len(dataBits),
+				Available: totalDatawords * 8,
+				Symbol:    "qr code",
 			}
 		}
 
-		break
+		return dataBits, version, totalDatawords, nil
+	}
+}
+
+// Encode segments into bits after the header bits, adding an eci assignment
+// and the fnc1 mode indicator when they are needed
+func encodeDataSegments(segments []segment, opts *CreateOptions, format dataFormat, header Bits) (Bits, error) {
+	// Mark the data with an eci assignment if required
+	eci := -1
+	if opts.ECI != nil {
+		eci = *opts.ECI
+	} else if needsUTF8ECI(segments) {
+		eci = ECIUTF8
+	}
+
+	dataBits := append(Bits{}, header...)
+	if eci >= 0 || opts.ECI != nil {
+		if eci < 0 || eci > 999999 {
+			return nil, fmt.Errorf("%w: invalid eci assignment %v", ErrUnsupportedMode, eci)
+		}
+
+		indicator, ok := format.specialModeIndicator(eciMode)
+		if !ok {
+			return nil, fmt.Errorf("%w: eci assignments are not supported by this type of code", ErrUnsupportedMode)
+		}
+
+		var err error
+		segments, err = convertSegmentsToECI(segments, eci)
+		if err != nil {
+			return nil, err
+		}
+
+		dataBits = append(dataBits, indicator...)
+		dataBits = append(dataBits, eciDesignator(eci)...)
+	}
+
+	if opts.GS1 {
+		// FNC1 in first position mode indicator
+		indicator, ok := format.specialModeIndicator(fnc1FirstMode)
+		if !ok {
+			return nil, fmt.Errorf("%w: gs1 is not supported by this type of code", ErrUnsupportedMode)
+		}
+
+		dataBits = append(dataBits, indicator...)
+	}
+
+	segmentBits, err := encodeSegments(segments, format, opts.GS1)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(dataBits, segmentBits...), nil
+}
+
+// Create a qr code with header bits before the data.
+// GS1 data must already be converted into an element string.
+func createQRCode(data []byte, opts *CreateOptions, header Bits) (*Symbol, error) {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+
+	if opts.ErrorCorrectionLevel == "" {
+		opts.ErrorCorrectionLevel = "M"
 	}
 
+	dataBits, version, totalDatawords, err := encodeData(data, opts, header)
+	if err != nil {
+		return nil, err
+	}
+
+	codewords := toCodewords(dataBits, totalDatawords*8, qrDataFormat(version).terminatorBits)
+
+	// Generate error correction
+	allwords := generateErrorWords(codewords, version, opts.ErrorCorrectionLevel)
+
+	s := newQRSymbol(version)
+	s.ErrorCorrectionLevel = opts.ErrorCorrectionLevel
+
+	// Draw the data onto the qr code with a zig-zag pattern
+	writeData(s, allwords)
+
+	// Apply the best mask
+	s.Mask = applyBestMask(s, opts.ErrorCorrectionLevel, version)
+	addFormatAndVersionInfo(s, opts.ErrorCorrectionLevel, s.Mask, version)
+
+	return s, nil
+}
+
+// Returns an empty qr code with its function patterns drawn
+func newQRSymbol(version int) *Symbol {
+	s := newSymbol(17+version*4, 17+version*4)
+	s.Version = version
+
+	// Draw finder patterns in three corners
+	drawFinderPattern(s, 0, 0)
+	drawFinderPattern(s, 0, s.Height()-7)
+	drawFinderPattern(s, s.Width()-7, 0)
+
+	// Place temporary format bits
+	drawTempFormatBits(s)
+	if version >= 7 {
+		drawTempVersionBits(s)
+	}
+
+	// Draw both timing patterns
+	drawTimingPatterns(s)
+
+	// Draw alignment patterns
+	drawAlignmentPatterns(s)
+
+	return s
+}
+
+// Add the terminator and padding to the data bits, and convert them into codewords.
+// If the capacity isn't a whole number of codewords, the last one only uses its upper 4 bits.
+func toCodewords(dataBits Bits, capacity int, terminatorBits int) []uint8 {
 	// Add terminator (if required)
-	for i := 0; i < 4 && len(dataBits) < totalDatawords*8; i++ {
+	for i := 0; i < terminatorBits && len(dataBits) < capacity; i++ {
 		dataBits = append(dataBits, 0)
 	}
 
 	// Pad to nearest 8 bits
-	for i := 0; i < len(dataBits)%8; i++ {
+	for len(dataBits)%8 != 0 {
 		dataBits = append(dataBits, 0)
 	}
 
@@ -116,51 +278,17 @@ func CreateQRCode(data []byte, opts *CreateOptions) *image.RGBA {
 	}
 
 	// Add padding codewords
+	totalDatawords := (capacity + 7) / 8
 	for i := 0; len(codewords) < totalDatawords; i++ {
-		if i%2 == 0 {
+		if capacity%8 != 0 && len(codewords) == totalDatawords-1 {
+			// A short last codeword is always zero
+			codewords = append(codewords, 0)
+		} else if i%2 == 0 {
 			codewords = append(codewords, 0b11101100)
 		} else {
 			codewords = append(codewords, 0b00010001)
 		}
 	}
 
-	// Generate error correction
-	allwords := generateErrorWords(codewords, version, opts.ErrorCorrectionLevel)
-
-	// Create image
-	i := image.NewRGBA(image.Rect(0, 0, 17+version*4, 17+version*4))
-
-	// Draw background (so we can see coding area)
-	iterateRect(i.Rect.Dx(), i.Rect.Dy(), func(x, y int) {
-		i.SetRGBA(x, y, BLUE)
-	})
-
-	// Draw finder patterns in three corners
-	drawFinderPattern(i, 0, 0)
-	drawFinderPattern(i, 0, i.Rect.Dy()-7)
-	drawFinderPattern(i, i.Rect.Dx()-7, 0)
-
-	// Place temporary format bits
-	drawTempFormatBits(i)
-	if version >= 7 {
-		drawTempVersionBits(i)
-	}
-
-	// Draw both timing patterns
-	drawTimingPatterns(i)
-
-	// Draw alignment patterns
-	drawAlignmentPatterns(i)
-
-	// Draw the data onto the qr code with a zig-zag pattern
-	writeData(i, allwords)
-
-	// Apply the best mask
-	pattern := applyBestMask(i, opts.ErrorCorrectionLevel, version)
-	addFormatAndVersionInfo(i, opts.ErrorCorrectionLevel, pattern, version)
-
-	// Place qr code in quiet zone
-	i = quietZone(i)
-
-	return i
+	return codewords
 }
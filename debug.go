@@ -0,0 +1,143 @@
+package polishedqr
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// The width of a module in the debug images of symbols, in pixels
+const debugModuleSize = 10
+
+// Images of each step of reading an image, for working out why a code can't be read
+type DebugInfo struct {
+	// The image split into dark and light, as it was when the codes were found,
+	// or as the last binarizer split it if none were
+	Binarized image.Image
+
+	// The grayscale image with the finder pattern candidates circled in red,
+	// and the alignment patterns that were found marked in green
+	Candidates image.Image
+
+	// The centres of the finder pattern candidates and alignment patterns, in pixels
+	FinderPatterns    []image.Point
+	AlignmentPatterns []image.Point
+
+	// Every symbol that was sampled, in the order they were tried
+	Symbols []DebugSymbol
+
+	finders []patternCandidate
+}
+
+// A symbol that was sampled from the image
+type DebugSymbol struct {
+	// The image warped so that each module is a square, with the points that were sampled marked in red
+	Grid image.Image
+
+	// The modules that were sampled, drawn at the same size as the grid
+	Modules image.Image
+
+	// Why the symbol couldn't be decoded, or nil if it was
+	Err error
+}
+
+// Start again with a new bitmap. Does nothing if d is nil, like the other methods
+func (d *DebugInfo) reset(b *bitmap) {
+	if d == nil {
+		return
+	}
+
+	*d = DebugInfo{}
+
+	img := image.NewGray(image.Rect(0, 0, b.width, b.height))
+	for k, v := range b.dark {
+		if !v {
+			img.Pix[k] = 255
+		}
+	}
+	d.Binarized = img
+}
+
+func (d *DebugInfo) addFinderPatterns(candidates []patternCandidate) {
+	if d == nil {
+		return
+	}
+
+	d.finders = append(d.finders, candidates...)
+	for _, v := range candidates {
+		d.FinderPatterns = append(d.FinderPatterns, image.Pt(int(v.center.x), int(v.center.y)))
+	}
+}
+
+func (d *DebugInfo) addAlignmentPattern(p point) {
+	if d == nil {
+		return
+	}
+
+	d.AlignmentPatterns = append(d.AlignmentPatterns, image.Pt(int(p.x), int(p.y)))
+}
+
+// Draw the finder and alignment patterns that were found over the grayscale image
+func (d *DebugInfo) drawCandidates(b *bitmap) {
+	if d == nil {
+		return
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, b.width, b.height))
+	for k, v := range b.gray {
+		img.Pix[k*4], img.Pix[k*4+1], img.Pix[k*4+2], img.Pix[k*4+3] = v, v, v, 255
+	}
+
+	for _, v := range d.finders {
+		drawCircle(img, v.center, v.moduleSize*3.5, RED)
+	}
+	for _, v := range d.AlignmentPatterns {
+		drawCircle(img, point{float64(v.X), float64(v.Y)}, 2, GREEN)
+	}
+
+	d.Candidates = img
+}
+
+// Record a symbol that was sampled with the transform, and whether it could be decoded
+func (d *DebugInfo) addSymbol(b *bitmap, transform Homography, s *Symbol, err error) {
+	if d == nil {
+		return
+	}
+
+	width, height := s.Width()*debugModuleSize, s.Height()*debugModuleSize
+	grid := image.NewRGBA(image.Rect(0, 0, width, height))
+	modules := image.NewRGBA(grid.Rect)
+	iterateRect(width, height, func(x, y int) {
+		// Take the grey level under the centre of each pixel of the grid
+		var c color.RGBA
+		p := point{(float64(x) + 0.5) / debugModuleSize, (float64(y) + 0.5) / debugModuleSize}
+		if v, ok := b.reflectanceAt(transform.transform(p)); ok {
+			level := uint8(v * 255)
+			c = color.RGBA{level, level, level, 255}
+		} else {
+			c = BLUE
+		}
+
+		if x%debugModuleSize == debugModuleSize/2 && y%debugModuleSize == debugModuleSize/2 {
+			c = RED
+		}
+		grid.SetRGBA(x, y, c)
+
+		if s.Modules[y/debugModuleSize][x/debugModuleSize] {
+			modules.SetRGBA(x, y, BLACK)
+		} else {
+			modules.SetRGBA(x, y, WHITE)
+		}
+	})
+
+	d.Symbols = append(d.Symbols, DebugSymbol{Grid: grid, Modules: modules, Err: err})
+}
+
+// Draw the outline of a circle
+func drawCircle(img *image.RGBA, centre point, radius float64, c color.RGBA) {
+	steps := int(math.Max(16, radius*8))
+	for i := 0; i < steps; i++ {
+		angle := float64(i) / float64(steps) * 2 * math.Pi
+		img.SetRGBA(int(centre.x+radius*math.Cos(angle)), int(centre.y+radius*math.Sin(angle)), c)
+	}
+}
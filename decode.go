@@ -0,0 +1,569 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"unicode/utf8"
+)
+
+type QRCodeResult struct {
+	ErrorCorrectionLevel string
+
+	// The character set of the first segment
+	CharacterSet CharacterSet
+
+	Version int
+	Data    []byte
+
+	// Set if the symbol is a micro qr code, where versions 1 to 4 are M1 to M4.
+	// M1 codes can only detect errors, and are given level L
+	Micro bool
+
+	// Every segment of the data, in order
+	Segments []Segment
+
+	// Set if the symbol is part of a structured append sequence
+	StructuredAppend *StructuredAppendInfo
+
+	// Set if the symbol holds GS1 data (FNC1 in first position).
+	// The data is the element string, with 0x1D separating fields
+	GS1                    bool
+	ApplicationIdentifiers []ApplicationIdentifier
+
+	// Set if the symbol uses FNC1 in second position, with the application indicator
+	FNC1SecondPosition   bool
+	ApplicationIndicator byte
+
+	// Set if the symbol was read with dark and light swapped
+	Inverted bool
+
+	// Set if the symbol was read as a mirror image. Its location still uses the
+	// module coordinates of the symbol, so the corners go around it anticlockwise
+	Mirrored bool
+
+	// The index of the mask pattern that was applied to the data.
+	// Micro qr codes only have 4 mask patterns
+	Mask int
+
+	// How much damage had to be corrected to decode the symbol
+	Quality DecodeQuality
+
+	// Where the symbol is in the image. Only set when reading from an image
+	Location *Location
+}
+
+// How much damage was corrected when decoding a symbol. Symbols that use more of their
+// error correction are closer to becoming unreadable
+type DecodeQuality struct {
+	// The number of codewords that were corrected in each error correction block
+	CorrectedCodewords []int
+
+	// The fraction of the error correction codewords that were needed, from 0 to 1.
+	// A codeword that was marked as an erasure takes one, and any other takes two
+	ECCapacityUsed float64
+
+	// The number of wrong bits in the best copy of the format information
+	FormatErrors int
+
+	// The number of wrong bits in the best copy of the version information, or -1 if there isn't any
+	VersionErrors int
+}
+
+// The position and geometry of a symbol in an image, in pixels
+type Location struct {
+	// The centre of the symbol
+	Center image.Point
+
+	// The corners of the symbol without its quiet zone, going clockwise
+	// from the top left (next to the finder pattern)
+	Corners [4]image.Point
+
+	// The average width of a module
+	ModuleSize float64
+
+	// How far the symbol is rotated clockwise, in degrees from 0 up to 360
+	Rotation float64
+
+	// Maps module coordinates onto pixels
+	Homography Homography
+}
+
+type StructuredAppendInfo struct {
+	// The position of this symbol in the sequence, starting from 0
+	Index int
+
+	// The number of symbols in the sequence
+	Total int
+
+	// The parity of the data of the whole sequence, which identifies it
+	Parity byte
+}
+
+// A run of decoded data that was encoded with a single character set
+type Segment struct {
+	CharacterSet CharacterSet
+
+	// The ECI assignment active for this segment, or -1 if there is none.
+	// Byte segments with a known charset are converted into utf-8.
+	ECI int
+
+	// The range of the decoded data that this segment makes up
+	Start int
+	End   int
+}
+
+// Reads integers from a series of bits
+type bitReader struct {
+	bits Bits
+	pos  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.bits) - r.pos
+}
+
+// Returns true if the next bits are the terminator, which may be shortened at the end of the data
+func isTerminator(r *bitReader, terminatorBits int) bool {
+	for i := r.pos; i < r.pos+terminatorBits && i < len(r.bits); i++ {
+		if r.bits[i] != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *bitReader) read(n int) (int, error) {
+	if r.remaining() < n {
+		return 0, errors.New("unexpected end of data")
+	}
+
+	var out int
+	for i := 0; i < n; i++ {
+		out = out<<1 | int(r.bits[r.pos+i])
+	}
+	r.pos += n
+
+	return out, nil
+}
+
+// Read both copies of the version information of a qr code, or -1 if neither can be decoded
+func readVersionInfo(s *Symbol) int {
+	return decodeVersion(versionInfoCopies(s)...)
+}
+
+// Returns the version information blocks of a qr code, from the top right and then the bottom left
+func versionInfoCopies(s *Symbol) []int {
+	var topRight, bottomLeft int
+	var i int
+	for y := 0; y < 6; y++ {
+		for x := s.Width() - 11; x < s.Width()-8; x++ {
+			if s.Dark(x, y) {
+				topRight |= (1 << i)
+			}
+			i++
+		}
+	}
+
+	i = 0
+	for x := 0; x < 6; x++ {
+		for y := s.Height() - 11; y < s.Height()-8; y++ {
+			if s.Dark(x, y) {
+				bottomLeft |= (1 << i)
+			}
+			i++
+		}
+	}
+
+	return []int{topRight, bottomLeft}
+}
+
+// Read both copies of the format information of a qr code, or -1 if neither can be decoded.
+// Also returns how many bits of the best copy were wrong
+func readFormatInfo(s *Symbol) (int, int) {
+	// Around the top left finder pattern, skipping the timing patterns
+	topLeft := [][2]int{
+		{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8},
+		{7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8},
+	}
+
+	// Split between the top right and bottom left finder patterns
+	var split [][2]int
+	for x := s.Width() - 1; x >= s.Width()-8; x-- {
+		split = append(split, [2]int{x, 8})
+	}
+	for y := s.Height() - 7; y < s.Height(); y++ {
+		split = append(split, [2]int{8, y})
+	}
+
+	var copies []int
+	for _, positions := range [][][2]int{topLeft, split} {
+		var formatBits int
+		for k, v := range positions {
+			if s.Dark(v[0], v[1]) {
+				formatBits |= (1 << k)
+			}
+		}
+
+		copies = append(copies, formatBits^0b101010000010010)
+	}
+
+	return decodeFormat(copies...)
+}
+
+// Read the codewords of a qr code in zig zag order, once its function patterns have been masked off
+func readCodewords(s *Symbol, maskPattern int) []uint8 {
+	bits := readBits(s, Masks[maskPattern], 6)
+
+	// Convert bits into codewords
+	var data []uint8
+	for i := 0; i < len(bits)-7; i += 8 {
+		var byt uint8
+		for j := 0; j < 8; j++ {
+			if bits[i+j] == 1 {
+				byt |= (1 << (7 - j))
+			}
+		}
+		data = append(data, byt)
+	}
+
+	return data
+}
+
+// Decode the modules of a qr code. confidence is how sure the reader is of each module,
+// from 0 to 1, or nil if it doesn't know
+func decodeQRCode(s *Symbol, confidence [][]float64) (QRCodeResult, error) {
+	version := (s.Width() - 17) / 4
+	if version < 1 || version > 40 || s.Width() != version*4+17 || s.Height() != s.Width() {
+		return QRCodeResult{}, fmt.Errorf("qr code can't be %vx%v modules", s.Width(), s.Height())
+	}
+
+	// Get format info
+	var ecLevel string
+	var maskPattern int
+	var formatErrors int
+	{
+		var formatBits int
+		formatBits, formatErrors = readFormatInfo(s)
+		if formatBits < 0 {
+			return QRCodeResult{}, errors.New("unable to decode format information")
+		}
+
+		switch formatBits >> 3 {
+		case 0:
+			ecLevel = "M"
+		case 1:
+			ecLevel = "L"
+		case 2:
+			ecLevel = "H"
+		case 3:
+			ecLevel = "Q"
+		}
+
+		maskPattern = formatBits & 0b111
+	}
+
+	// Mask off fixed patterns
+	s.Function = newQRSymbol(version).Function
+
+	// Read data
+	data := readCodewords(s, maskPattern)
+
+	// A codeword is only as certain as its least certain module
+	var wordConfidence []float64
+	if confidence != nil {
+		var i int
+		zigZag(s, 6, func(x, y int) {
+			if i%8 == 0 {
+				wordConfidence = append(wordConfidence, 1)
+			}
+			wordConfidence[i/8] = math.Min(wordConfidence[i/8], confidence[y][x])
+			i++
+		})
+	}
+
+	result := QRCodeResult{
+		ErrorCorrectionLevel: ecLevel,
+		Version:              version,
+		Mask:                 maskPattern,
+		Quality: DecodeQuality{
+			FormatErrors:  formatErrors,
+			VersionErrors: -1,
+		},
+	}
+
+	if version >= 7 {
+		// Count the errors against the version the code was read as
+		expected := (version << 12) | checkVersion(version<<12)
+		result.Quality.VersionErrors = 18
+		for _, v := range versionInfoCopies(s) {
+			if d := hammingWeight(v ^ expected); d < result.Quality.VersionErrors {
+				result.Quality.VersionErrors = d
+			}
+		}
+	}
+
+	// Split codewords into blocks & error correct
+	datawords, err := correctDataWords(data, wordConfidence, version, ecLevel, &result.Quality)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	// Decode every segment
+	err = decodeData(datawords, len(datawords)*8, qrDataFormat(version), &result)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	return result, nil
+}
+
+// Decode the data codewords of a symbol, segment by segment, until the terminator.
+// Only the first dataBits bits are used, as the last codeword of some micro qr codes is only 4 bits.
+func decodeData(datawords []uint8, dataBits int, format dataFormat, result *QRCodeResult) error {
+	// Convert back into bits
+	var bits Bits
+	for _, v := range datawords {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, (v>>i)&1)
+		}
+	}
+	if dataBits < len(bits) {
+		bits = bits[:dataBits]
+	}
+
+	modes := reverseMap(format.modes)
+	r := &bitReader{bits: bits}
+	var data []byte
+	var segments []Segment
+	eci := -1
+	fnc1 := false
+	for {
+		// The terminator may be shortened or omitted if the symbol is full
+		if r.remaining() == 0 || r.remaining() < format.modeBits {
+			break
+		}
+		if isTerminator(r, format.terminatorBits) {
+			break
+		}
+
+		mode, _ := r.read(format.modeBits)
+
+		var err error
+		start := len(data)
+		charset, ok := modes[mode]
+		if ok {
+			countBits := format.countBits[charset]
+			switch charset {
+			case Numeric:
+				data, err = decodeNumeric(r, data, countBits)
+			case Alphanumeric:
+				data, err = decodeAlphanumeric(r, data, countBits)
+				if err == nil && fnc1 {
+					data = append(data[:start], unescapeFNC1(data[start:])...)
+				}
+			case Bytes:
+				data, err = decodeBytes(r, data, countBits)
+				if err == nil && eci >= 0 {
+					// Convert the segment into utf-8 if we know the charset
+					converted, _ := eciToUTF8(data[start:], eci)
+					data = append(data[:start], converted...)
+				}
+			case Kanji:
+				data, err = decodeKanji(r, data, countBits)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			segments = append(segments, Segment{
+				CharacterSet: charset,
+				ECI:          eci,
+				Start:        start,
+				End:          len(data),
+			})
+			continue
+		}
+
+		special, ok := format.specialModes[mode]
+		if !ok {
+			return fmt.Errorf("unknown character set (mode indicator %0*b)", format.modeBits, mode)
+		}
+
+		switch special {
+		case eciMode:
+			// ECI designator, which applies until the next one
+			eci, err = readECIDesignator(r)
+			if err != nil {
+				return err
+			}
+		case structuredAppendMode:
+			// Structured append header
+			var index, total, parity int
+			index, err = r.read(4)
+			if err == nil {
+				total, err = r.read(4)
+			}
+			if err == nil {
+				parity, err = r.read(8)
+			}
+			if err != nil {
+				return err
+			}
+
+			result.StructuredAppend = &StructuredAppendInfo{
+				Index:  index,
+				Total:  total + 1,
+				Parity: byte(parity),
+			}
+		case fnc1FirstMode:
+			fnc1 = true
+			result.GS1 = true
+		case fnc1SecondMode:
+			// Followed by the application indicator
+			var indicator int
+			indicator, err = r.read(8)
+			if err != nil {
+				return err
+			}
+
+			fnc1 = true
+			result.FNC1SecondPosition = true
+			result.ApplicationIndicator = byte(indicator)
+		}
+	}
+
+	result.Data = data
+	result.Segments = segments
+	if len(segments) > 0 {
+		result.CharacterSet = segments[0].CharacterSet
+	}
+
+	if result.GS1 {
+		// Invalid GS1 data is still returned, just without the fields
+		result.ApplicationIdentifiers, _ = parseGS1ElementString(data)
+	}
+
+	return nil
+}
+
+func decodeNumeric(r *bitReader, data []byte, countBits int) ([]byte, error) {
+	charCount, err := r.read(countBits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Divide into groups of 3 digits (or less) and convert
+	for i := 0; i < charCount; i += 3 {
+		digits := 3
+		bc := 10
+		if charCount-i == 2 {
+			digits = 2
+			bc = 7
+		} else if charCount-i == 1 {
+			digits = 1
+			bc = 4
+		}
+
+		group, err := r.read(bc)
+		if err != nil {
+			return nil, err
+		}
+
+		s := fmt.Sprintf("%03v", group)
+		if len(s) > 3 {
+			return nil, errors.New("invalid numeric group")
+		}
+		data = append(data, s[3-digits:]...)
+	}
+
+	return data, nil
+}
+
+func decodeAlphanumeric(r *bitReader, data []byte, countBits int) ([]byte, error) {
+	charCount, err := r.read(countBits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Divide into groups of 2 characters (or less) and convert
+	for i := 0; i < charCount; i += 2 {
+		bc := 11
+		if charCount-i == 1 {
+			bc = 6
+		}
+
+		group, err := r.read(bc)
+		if err != nil {
+			return nil, err
+		}
+
+		if charCount-i == 1 {
+			if group >= 45 {
+				return nil, errors.New("invalid alphanumeric group")
+			}
+			data = append(data, alphanumericTableReverse[group])
+		} else {
+			if group >= 45*45 {
+				return nil, errors.New("invalid alphanumeric group")
+			}
+			data = append(data, alphanumericTableReverse[group/45])
+			data = append(data, alphanumericTableReverse[group%45])
+		}
+	}
+
+	return data, nil
+}
+
+func decodeBytes(r *bitReader, data []byte, countBits int) ([]byte, error) {
+	charCount, err := r.read(countBits)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < charCount; i++ {
+		byt, err := r.read(8)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, byte(byt))
+	}
+
+	return data, nil
+}
+
+// Returns the characters as utf-8
+func decodeKanji(r *bitReader, data []byte, countBits int) ([]byte, error) {
+	charCount, err := r.read(countBits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand each 13 bit group back into a double-byte character
+	for i := 0; i < charCount; i++ {
+		group, err := r.read(13)
+		if err != nil {
+			return nil, err
+		}
+
+		// Undo the compaction, then add the offset of the range the character is in
+		c := (group/0xC0)<<8 | group%0xC0
+		if c+0x8140 <= 0x9FFC {
+			c += 0x8140
+		} else {
+			c += 0xC140
+		}
+
+		char, ok := shiftJISTableReverse[uint16(c)]
+		if !ok {
+			return nil, errors.New("invalid kanji character")
+		}
+		data = utf8.AppendRune(data, char)
+	}
+
+	return data, nil
+}
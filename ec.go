@@ -2,6 +2,7 @@ package polishedqr
 
 import (
 	"errors"
+	"sort"
 )
 
 type block struct {
@@ -13,15 +14,20 @@ type block struct {
 
 // Retunrs the combined data words and error words
 func generateErrorWords(codewords []uint8, version int, ecLevel string) []uint8 {
+	return generateBlockErrorWords(codewords, codeWordTable[version][ecLevel])
+}
+
+// Returns the combined data words and error words of any arrangement of blocks
+func generateBlockErrorWords(codewords []uint8, table ecBlocks) []uint8 {
 	var blocks []*block
 
 	// Split codewords into blocks
 	var c int
-	for _, blockType := range codeWordTable[version][ecLevel].blocks {
+	for _, blockType := range table.blocks {
 		for i := 0; i < blockType.count; i++ {
 			blocks = append(blocks, &block{
 				dataWords: codewords[c : c+blockType.dataWords],
-				ecCount:   codeWordTable[version][ecLevel].ecWordsPerBlock,
+				ecCount:   table.ecWordsPerBlock,
 				dataCount: blockType.dataWords,
 			})
 			c += blockType.dataWords
@@ -53,7 +59,10 @@ func generateErrorWords(codewords []uint8, version int, ecLevel string) []uint8
 	return out
 }
 
-func correctDataWords(allWords []uint8, version int, ecLevel string) ([]uint8, error) {
+// Split the codewords of a qr code into blocks and correct each of them, recording how much was corrected in quality.
+// confidence is how sure the reader is of each codeword, from 0 to 1, or nil if it doesn't know.
+// The least certain codewords are treated as erasures, which doubles how many can be corrected
+func correctDataWords(allWords []uint8, confidence []float64, version int, ecLevel string, quality *DecodeQuality) ([]uint8, error) {
 	// Generate the empty blocks
 	var blocks []*block
 	for _, blockType := range codeWordTable[version][ecLevel].blocks {
@@ -65,6 +74,15 @@ func correctDataWords(allWords []uint8, version int, ecLevel string) ([]uint8, e
 		}
 	}
 
+	// The confidence of each codeword in each block
+	blockConfidence := make([][]float64, len(blocks))
+	wordConfidence := func(i int) float64 {
+		if i < len(confidence) {
+			return confidence[i]
+		}
+		return 1
+	}
+
 	// Disassmble the sequence, putting to each block in turn
 	var i int
 	for {
@@ -72,9 +90,11 @@ func correctDataWords(allWords []uint8, version int, ecLevel string) ([]uint8, e
 			// Fill up data blocks, then ec blocks
 			if len(v.dataWords) < v.dataCount {
 				v.dataWords = append(v.dataWords, allWords[i])
+				blockConfidence[k] = append(blockConfidence[k], wordConfidence(i))
 				i++
 			} else if len(v.errorWords) < v.ecCount && len(blocks[len(blocks)-1].dataWords) == blocks[len(blocks)-1].dataCount {
 				v.errorWords = append(v.errorWords, allWords[i])
+				blockConfidence[k] = append(blockConfidence[k], wordConfidence(i))
 				i++
 			} else if k == len(blocks)-1 {
 				// Last block is filled, we are done
@@ -86,7 +106,9 @@ func correctDataWords(allWords []uint8, version int, ecLevel string) ([]uint8, e
 ec:
 	// Perform error correction
 	var out []uint8
-	for _, v := range blocks {
+	var used, capacity int
+	quality.CorrectedCodewords = make([]int, len(blocks))
+	for k, v := range blocks {
 		var msgInt []int
 		for _, v := range v.dataWords {
 			msgInt = append(msgInt, int(v))
@@ -95,11 +117,25 @@ ec:
 			msgInt = append(msgInt, int(v))
 		}
 
-		corrected, _, err := correctMessage(msgInt, v.ecCount)
+		erasures := findErasures(blockConfidence[k], v.ecCount)
+		corrected, correctedPos, err := correctMessage(msgInt, v.ecCount, erasures)
+		if err == nil && ecCapacityUsed(correctedPos, erasures) > v.ecCount-erasureSpare {
+			// Without spare syndromes, any correction looks right, so it can't be trusted
+			err = errors.New("too many errors to correct with erasures")
+		}
+		if err != nil && len(erasures) > 0 {
+			// Some of the erasures might have been read correctly, so try again without them
+			erasures = nil
+			corrected, correctedPos, err = correctMessage(msgInt, v.ecCount, nil)
+		}
 		if err != nil {
 			return []uint8{}, err
 		}
 
+		quality.CorrectedCodewords[k] = len(correctedPos)
+		used += ecCapacityUsed(correctedPos, erasures)
+		capacity += v.ecCount
+
 		correctedByt := make([]uint8, len(corrected))
 		for k := range corrected {
 			correctedByt[k] = uint8(corrected[k])
@@ -108,9 +144,57 @@ ec:
 		out = append(out, correctedByt...)
 	}
 
+	quality.ECCapacityUsed = float64(used) / float64(capacity)
+
 	return out, nil
 }
 
+// Returns how many ec codewords it took to make the corrections. Every erasure takes one,
+// and every other corrected codeword takes two, as its position had to be found as well
+func ecCapacityUsed(correctedPos, erasures []int) int {
+	used := len(erasures)
+outer:
+	for _, p := range correctedPos {
+		for _, e := range erasures {
+			if p == e {
+				continue outer
+			}
+		}
+		used += 2
+	}
+
+	return used
+}
+
+// Codewords that the reader is less sure of than this are treated as erasures
+const erasureConfidence = 0.5
+
+// The number of ec codewords that are left spare when correcting erasures.
+// Their syndromes check the correction, which could otherwise be wrong without it being noticed
+const erasureSpare = 2
+
+// Returns the positions of the least certain codewords of a block, leaving some ec codewords spare
+func findErasures(confidence []float64, ecCount int) []int {
+	var erasures []int
+	for k, v := range confidence {
+		if v < erasureConfidence {
+			erasures = append(erasures, k)
+		}
+	}
+
+	sort.SliceStable(erasures, func(i, j int) bool {
+		return confidence[erasures[i]] < confidence[erasures[j]]
+	})
+	if limit := ecCount - erasureSpare; len(erasures) > limit {
+		if limit < 0 {
+			limit = 0
+		}
+		erasures = erasures[:limit]
+	}
+
+	return erasures
+}
+
 func rsGenerator(symbols int) []int {
 	g := []int{1}
 	for i := 0; i < symbols; i++ {
@@ -365,7 +449,7 @@ func findErrors(err_loc []int, nmess int) ([]int, error) {
 func forneySyndromes(synd, pos []int, nmess int) []int {
 	// Compute Forney syndromes, which computes a modified syndromes to compute only errors (erasures are trimmed out). Do not confuse this with Forney algorithm, which allows to correct the message based on the location of errors.
 	var erase_pos_reversed []int
-	for p := range pos {
+	for _, p := range pos {
 		erase_pos_reversed = append(erase_pos_reversed, nmess-1-p) // prepare the coefficient degree positions (instead of the erasures positions)
 	}
 
@@ -388,29 +472,35 @@ func forneySyndromes(synd, pos []int, nmess int) []int {
 	return fsynd
 }
 
-// Reed-Solomon main decoding function
-func correctMessage(msg_in []int, nsym int) ([]int, []int, error) {
+// Reed-Solomon main decoding function. erase_pos are the positions of symbols that are known to be wrong,
+// which only take half as much of the ec symbols to correct as errors do.
+// Returns the corrected data, and the positions of every symbol that was corrected
+func correctMessage(msg_in []int, nsym int, erase_pos []int) ([]int, []int, error) {
 	if len(msg_in) > 255 {
 		return []int{}, []int{}, errors.New("message is too long")
 	}
 
-	msg_out := make([]int, len(msg_in)) // copy of message
-	copy(msg_out, msg_in)
-	// erasures: set them to null bytes for easier decoding (but this is not necessary, they will be corrected anyway, but debugging will be easier with null bytes because the error locator polynomial values will only depend on the errors locations, not their values)
-	var erase_pos []int
 	// check if there are too many erasures to correct (beyond the Singleton bound)
 	if len(erase_pos) > nsym {
 		return []int{}, []int{}, errors.New("too many erasures to correct")
 	}
-	// prepare the syndrome polynomial using only errors (ie: errors = characters that were either replaced by null byte
-	// or changed to another character, but we don't know their positions)
-	synd := calcSyndromes(msg_out, nsym)
+
+	msg_out := make([]int, len(msg_in)) // copy of message
+	copy(msg_out, msg_in)
 	// check if there's any error/erasure in the input codeword. If not (all syndromes coefficients are 0), then just return the message as-is.
 	if checkMessage(msg_in, nsym) {
 		// no errors
-		return msg_out[:len(msg_out)-nsym], msg_out[len(msg_out)-nsym:], nil
+		return msg_out[:len(msg_out)-nsym], []int{}, nil
 	}
 
+	// erasures: set them to null bytes for easier decoding (but this is not necessary, they will be corrected anyway, but debugging will be easier with null bytes because the error locator polynomial values will only depend on the errors locations, not their values)
+	for _, p := range erase_pos {
+		msg_out[p] = 0
+	}
+	// prepare the syndrome polynomial using only errors (ie: errors = characters that were either replaced by null byte
+	// or changed to another character, but we don't know their positions)
+	synd := calcSyndromes(msg_out, nsym)
+
 	// compute the Forney syndromes, which hide the erasures from the original syndrome (so that BM will just have to deal with errors, not erasures)
 	fsynd := forneySyndromes(synd, erase_pos, len(msg_out))
 	// compute the error locator polynomial using Berlekamp-Massey
@@ -425,13 +515,19 @@ func correctMessage(msg_in []int, nsym int) ([]int, []int, error) {
 		return []int{}, []int{}, err
 	}
 
-	if len(err_pos) == 0 {
+	if len(err_pos) == 0 && len(erase_pos) == 0 {
 		return []int{}, []int{}, errors.New("could not locate error")
 	}
 
+	// Each error takes two ec symbols to correct, and each erasure takes one
+	if len(err_pos)*2+len(erase_pos) > nsym {
+		return []int{}, []int{}, errors.New("too many errors to correct")
+	}
+
 	// Find errors values and apply them to correct the message
 	// compute errata evaluator and errata magnitude polynomials, then correct errors and erasures
-	msg_out, err = correctErrata(msg_out, synd, append(erase_pos, err_pos...)) // note that we here use the original syndrome, not the forney syndrome
+	errata_pos := append(append([]int{}, erase_pos...), err_pos...)
+	msg_out, err = correctErrata(msg_out, synd, errata_pos) // note that we here use the original syndrome, not the forney syndrome
 	// (because we will correct both errors and erasures, so we need the full syndrome)
 	if err != nil {
 		return []int{}, []int{}, err
@@ -442,8 +538,16 @@ func correctMessage(msg_in []int, nsym int) ([]int, []int, error) {
 		return []int{}, []int{}, errors.New("could not correct message")
 	}
 
+	// find which symbols were actually changed, as erasures may have been right all along
+	var corrected_pos []int
+	for k := range msg_in {
+		if msg_in[k] != msg_out[k] {
+			corrected_pos = append(corrected_pos, k)
+		}
+	}
+
 	// return the successfully decoded message
-	return msg_out[:len(msg_out)-nsym], msg_out[len(msg_out)-nsym:], nil // also return the corrected ecc block so that the user can check()
+	return msg_out[:len(msg_out)-nsym], corrected_pos, nil
 }
 
 // Positive modulo, returns non negative solution to x `%` d
@@ -632,38 +736,46 @@ func checkVersion(fmt int) int {
 	return fmt
 }
 
-func decodeFormat(format int) int {
+// Returns the format closest to any of the copies of the format bits and how many bits of that copy were wrong,
+// or -1 if none of them are within 3 errors of one format
+func decodeFormat(copies ...int) (int, int) {
 	bestFmt := -1
-	bestDist := 15
+	bestDist := 4
 	for testFmt := 0; testFmt < 32; testFmt++ {
 		testCode := (testFmt << 10) ^ checkFormat(testFmt<<10)
-		testDist := hammingWeight(format ^ testCode)
-		if testDist < bestDist {
-			bestDist = testDist
-			bestFmt = testFmt
-		} else if testDist == bestDist {
-			bestFmt = -1
+		for _, format := range copies {
+			testDist := hammingWeight(format ^ testCode)
+			if testDist < bestDist {
+				bestDist = testDist
+				bestFmt = testFmt
+			} else if testDist == bestDist && testFmt != bestFmt {
+				bestFmt = -1
+			}
 		}
 	}
 
-	return bestFmt
+	return bestFmt, bestDist
 }
 
-func decodeVersion(version int) int {
-	bestFmt := -1
-	bestDist := 18
+// Returns the version closest to any of the copies of the version information,
+// or -1 if none of them are within 3 errors of one version
+func decodeVersion(copies ...int) int {
+	bestVer := -1
+	bestDist := 4
 	for testVer := 0; testVer < 32*2; testVer++ {
 		testCode := (testVer << 12) ^ checkVersion(testVer<<12)
-		testDist := hammingWeight(version ^ testCode)
-		if testDist < bestDist {
-			bestDist = testDist
-			bestFmt = testVer
-		} else if testDist == bestDist {
-			bestFmt = -1
+		for _, version := range copies {
+			testDist := hammingWeight(version ^ testCode)
+			if testDist < bestDist {
+				bestDist = testDist
+				bestVer = testVer
+			} else if testDist == bestDist && testVer != bestVer {
+				bestVer = -1
+			}
 		}
 	}
 
-	return bestFmt
+	return bestVer
 }
 
 // I love plagiarism
@@ -0,0 +1,100 @@
+package polishedqr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// Correct a block of a version 1-M code, which has 10 ec codewords, with some codewords
+// marked as erasures and some other codewords wrong without being marked
+func TestCorrectErasures(t *testing.T) {
+	data := []uint8("0123456789abcdef")
+	codewords := append(append([]uint8{}, data...), rsEncode(data, 10)...)
+
+	for _, v := range []struct {
+		name     string
+		erasures int
+		errors   int
+		correct  bool
+	}{
+		{"erasures only", 8, 0, true},
+		{"erasures and an error", 6, 1, true},
+
+		// Every syndrome would be used, so the wrong correction can't be noticed
+		{"too many erasures", 10, 1, false},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			received := append([]uint8{}, codewords...)
+			confidence := make([]float64, len(codewords))
+			for k := range confidence {
+				confidence[k] = 1
+			}
+
+			for i := 0; i < v.erasures+v.errors; i++ {
+				pos := i * 2
+				received[pos] ^= uint8(0x5a + i)
+				if i < v.erasures {
+					confidence[pos] = 0.1
+				}
+			}
+
+			var quality DecodeQuality
+			out, err := correctDataWords(received, confidence, 1, "M", &quality)
+			if v.correct {
+				if err != nil {
+					t.Fatalf("error correcting block: %v", err)
+				}
+				if !bytes.Equal(out, data) {
+					t.Fatalf("corrected to %q, expected %q", out, data)
+				}
+			} else if err == nil && !bytes.Equal(out, data) {
+				t.Fatalf("corrected to %q without an error, expected %q", out, data)
+			}
+		})
+	}
+}
+
+// Smudge a code so that more codewords are wrong than errors alone could correct,
+// but faintly enough that the reader knows which ones they are
+func TestReadErasures(t *testing.T) {
+	data := "erasures"
+	s, err := Create([]byte(data), &CreateOptions{Version: 1, ErrorCorrectionLevel: "M"})
+	if err != nil {
+		t.Fatalf("error creating code: %v", err)
+	}
+
+	const scale = 4
+	img := s.Render(scale)
+	q := s.QuietZone()
+
+	// Columns 17 to 20 of rows 9 to 20 hold the first 6 codewords. Swap each module
+	// to a gray just on the other side of the threshold
+	for y := 9; y <= 20; y++ {
+		for x := 17; x <= 20; x++ {
+			c := color.RGBA{140, 140, 140, 255}
+			if !s.Dark(x, y) {
+				c = color.RGBA{115, 115, 115, 255}
+			}
+			draw.Draw(img, image.Rect((q+x)*scale, (q+y)*scale, (q+x+1)*scale, (q+y+1)*scale), &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+
+	result, err := ReadFromImage(img, nil)
+	if err != nil {
+		t.Fatalf("error reading code: %v", err)
+	}
+	if string(result.Data) != data {
+		t.Fatalf("read %q, expected %q", result.Data, data)
+	}
+
+	// Each erasure takes one ec codeword, where an error would take two
+	if c := result.Quality.CorrectedCodewords; len(c) != 1 || c[0] != 6 {
+		t.Errorf("corrected %v codewords, expected 6", c)
+	}
+	if used := result.Quality.ECCapacityUsed; used != 0.6 {
+		t.Errorf("used %v of the ec capacity, expected 0.6", used)
+	}
+}
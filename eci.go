@@ -0,0 +1,242 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Some common ECI assignments
+const (
+	ECIISO8859_1 = 3
+	ECIShiftJIS  = 20
+	ECIUTF8      = 26
+)
+
+// Maps ECI assignments to the part of ISO-8859 they represent
+var eciISO8859Parts = map[int]int{
+	1:  1,
+	3:  1,
+	4:  2,
+	5:  3,
+	6:  4,
+	7:  5,
+	8:  6,
+	9:  7,
+	10: 8,
+	11: 9,
+	12: 10,
+	13: 11,
+	15: 13,
+	16: 14,
+	17: 15,
+	18: 16,
+}
+
+// Returns the bits of an ECI header, including the mode indicator
+func ConvertToECI(eci int) Bits {
+	var b Bits
+
+	// Add mode indicator
+	b = append(b, Bits{0, 1, 1, 1}...)
+
+	return append(b, eciDesignator(eci)...)
+}
+
+// Returns the bits of an ECI designator, which follows the mode indicator
+func eciDesignator(eci int) Bits {
+	// Designators are 1, 2 or 3 bytes long, with the length given by the leading bits
+	var designator, bc int
+	if eci < 0 || eci > 999999 {
+		panic("invalid eci assignment")
+	} else if eci < 1<<7 {
+		designator = eci
+		bc = 8
+	} else if eci < 1<<14 {
+		designator = 0b10<<14 | eci
+		bc = 16
+	} else {
+		designator = 0b110<<21 | eci
+		bc = 24
+	}
+
+	return toBits(designator, bc)
+}
+
+// Reads an ECI designator (after the mode indicator)
+func readECIDesignator(r *bitReader) (int, error) {
+	first, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+
+	if first&0x80 == 0 {
+		return first, nil
+	} else if first&0xC0 == 0x80 {
+		rest, err := r.read(8)
+		if err != nil {
+			return 0, err
+		}
+		return (first&0x3F)<<8 | rest, nil
+	} else if first&0xE0 == 0xC0 {
+		rest, err := r.read(16)
+		if err != nil {
+			return 0, err
+		}
+		return (first&0x1F)<<16 | rest, nil
+	}
+
+	return 0, errors.New("invalid eci designator")
+}
+
+// Returns true if any byte segment contains utf-8 characters that aren't ascii.
+// Readers assume ISO-8859-1 without an eci assignment, so they can only read these correctly
+// if the segment is marked as utf-8
+func needsUTF8ECI(segments []segment) bool {
+	for _, v := range segments {
+		if v.mode != Bytes || !utf8.Valid(v.data) {
+			continue
+		}
+
+		for _, r := range string(v.data) {
+			if r >= 0x80 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Convert the byte segments from utf-8 into the charset of the eci assignment.
+// Segments are left alone if the charset is unknown.
+func convertSegmentsToECI(segments []segment, eci int) ([]segment, error) {
+	var out []segment
+	for _, v := range segments {
+		if v.mode == Bytes {
+			converted, err := utf8ToECI(v.data, eci)
+			if err != nil {
+				return nil, err
+			}
+			v.data = converted
+		}
+
+		out = append(out, v)
+	}
+
+	return out, nil
+}
+
+func utf8ToECI(data []byte, eci int) ([]byte, error) {
+	var encode func(r rune) ([]byte, bool)
+	if part, ok := eciISO8859Parts[eci]; ok {
+		encode = func(r rune) ([]byte, bool) {
+			if r < 0xA0 || (part == 1 && r <= 0xFF) {
+				return []byte{byte(r)}, true
+			}
+
+			for k, v := range iso8859Tables[part] {
+				if v == r {
+					return []byte{byte(0xA0 + k)}, true
+				}
+			}
+			return nil, false
+		}
+	} else if eci == ECIShiftJIS {
+		encode = func(r rune) ([]byte, bool) {
+			if r < 0x80 {
+				return []byte{byte(r)}, true
+			} else if r >= 0xFF61 && r <= 0xFF9F {
+				// Half-width katakana
+				return []byte{byte(r - 0xFF61 + 0xA1)}, true
+			}
+
+			c, ok := shiftJISTable[r]
+			return []byte{byte(c >> 8), byte(c)}, ok
+		}
+	} else {
+		// UTF-8 or an unknown charset, which we can't convert to
+		return data, nil
+	}
+
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: data to convert to eci charset must be utf-8", ErrInvalidCharacters)
+	}
+
+	var out []byte
+	for _, r := range string(data) {
+		b, ok := encode(r)
+		if !ok {
+			return nil, fmt.Errorf("%w: character %q cannot be represented with eci %v", ErrInvalidCharacters, r, eci)
+		}
+		out = append(out, b...)
+	}
+
+	return out, nil
+}
+
+// Convert the byte segments of a result that don't have an ECI assignment into utf-8, as if they had eci.
+// Their ECI is left as -1, because the code doesn't have one
+func assumeECI(result *QRCodeResult, eci int) {
+	var data []byte
+	for k, v := range result.Segments {
+		segment := result.Data[v.Start:v.End]
+		if v.CharacterSet == Bytes && v.ECI < 0 {
+			if converted, ok := eciToUTF8(segment, eci); ok {
+				segment = converted
+			}
+		}
+
+		result.Segments[k].Start = len(data)
+		data = append(data, segment...)
+		result.Segments[k].End = len(data)
+	}
+
+	if result.Segments != nil {
+		result.Data = data
+	}
+}
+
+// Convert data from the charset of the eci assignment into utf-8.
+// Returns false if the charset is unknown.
+func eciToUTF8(data []byte, eci int) ([]byte, bool) {
+	var out []byte
+	if part, ok := eciISO8859Parts[eci]; ok {
+		for _, v := range data {
+			r := rune(v)
+			if v >= 0xA0 && part != 1 {
+				r = iso8859Tables[part][v-0xA0]
+				if r == 0 {
+					r = utf8.RuneError
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		}
+	} else if eci == ECIShiftJIS {
+		for i := 0; i < len(data); i++ {
+			v := data[i]
+			if v < 0x80 {
+				out = append(out, v)
+			} else if v >= 0xA1 && v <= 0xDF {
+				// Half-width katakana
+				out = utf8.AppendRune(out, rune(v)-0xA1+0xFF61)
+			} else if i+1 < len(data) {
+				// Double-byte character
+				r, ok := shiftJISTableReverse[uint16(v)<<8|uint16(data[i+1])]
+				if !ok {
+					r = utf8.RuneError
+				}
+				out = utf8.AppendRune(out, r)
+				i++
+			} else {
+				out = utf8.AppendRune(out, utf8.RuneError)
+			}
+		}
+	} else if eci == ECIUTF8 {
+		out = data
+	} else {
+		return data, false
+	}
+
+	return out, true
+}
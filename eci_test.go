@@ -0,0 +1,55 @@
+package polishedqr
+
+import (
+	"errors"
+	"testing"
+)
+
+// Create codes marked with ECI assignments and read them back, checking that byte segments
+// are converted into the charset of the assignment and back into utf-8
+func TestECIRoundTrip(t *testing.T) {
+	iso8859_1, iso8859_7, shiftJIS, utf8 := ECIISO8859_1, 9, ECIShiftJIS, ECIUTF8
+	for _, v := range []struct {
+		name     string
+		data     string
+		eci      *int
+		expected int
+	}{
+		{"utf-8 by default", "café", nil, ECIUTF8},
+		{"utf-8", "naïve ☃", &utf8, ECIUTF8},
+		{"iso-8859-1", "café", &iso8859_1, ECIISO8859_1},
+		{"iso-8859-7", "καλημέρα", &iso8859_7, 9},
+		{"shift jis", "ｺｰﾋｰ and 漢字", &shiftJIS, ECIShiftJIS},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			s, err := Create([]byte(v.data), &CreateOptions{ECI: v.eci})
+			if err != nil {
+				t.Fatalf("error creating code: %v", err)
+			}
+
+			result := readSymbol(t, s, nil)
+			if string(result.Data) != v.data {
+				t.Fatalf("read %q, expected %q", result.Data, v.data)
+			}
+			for k, seg := range result.Segments {
+				if seg.ECI != v.expected {
+					t.Errorf("segment %v has eci %v, expected %v", k, seg.ECI, v.expected)
+				}
+			}
+		})
+	}
+
+	// Ascii doesn't need an assignment
+	s, err := Create([]byte("plain"), nil)
+	if err != nil {
+		t.Fatalf("error creating code: %v", err)
+	}
+	if result := readSymbol(t, s, nil); result.Segments[0].ECI != -1 {
+		t.Errorf("ascii has eci %v, expected none", result.Segments[0].ECI)
+	}
+
+	// Characters that aren't in the charset of the assignment
+	if _, err := Create([]byte("café ☃"), &CreateOptions{ECI: &iso8859_1}); !errors.Is(err, ErrInvalidCharacters) {
+		t.Errorf("creating a snowman in iso-8859-1 returned %v, expected %v", err, ErrInvalidCharacters)
+	}
+}
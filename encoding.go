@@ -2,8 +2,10 @@ package polishedqr
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
 	"strconv"
+	"unicode/utf8"
 )
 
 type CharacterSet int
@@ -12,7 +14,7 @@ const (
 	Numeric = iota
 	Alphanumeric
 	Bytes
-	// Kanji not currently supported
+	Kanji
 )
 
 var numericRE = regexp.MustCompile(`\d+`)
@@ -24,11 +26,28 @@ func AutodetectCharacterSet(data []byte) CharacterSet {
 		return Numeric
 	} else if bytes.Equal(alphanumericRE.Find(data), data) {
 		return Alphanumeric
+	} else if isKanji(data) {
+		return Kanji
 	} else {
 		return Bytes
 	}
 }
 
+// Returns true if data is utf-8 made up entirely of double-byte Shift JIS characters
+func isKanji(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+
+	for _, r := range string(data) {
+		if _, ok := shiftJISTable[r]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
 type Bits []uint8
 
 func CharacterCountBitCapacity(mode CharacterSet, version int) (bitCapacity int) {
@@ -42,6 +61,8 @@ func CharacterCountBitCapacity(mode CharacterSet, version int) (bitCapacity int)
 			bitCapacity = 9
 		case Bytes:
 			bitCapacity = 8
+		case Kanji:
+			bitCapacity = 8
 		}
 	} else if version < 27 {
 		switch mode {
@@ -51,6 +72,8 @@ func CharacterCountBitCapacity(mode CharacterSet, version int) (bitCapacity int)
 			bitCapacity = 11
 		case Bytes:
 			bitCapacity = 16
+		case Kanji:
+			bitCapacity = 10
 		}
 	} else {
 		switch mode {
@@ -60,6 +83,8 @@ func CharacterCountBitCapacity(mode CharacterSet, version int) (bitCapacity int)
 			bitCapacity = 13
 		case Bytes:
 			bitCapacity = 16
+		case Kanji:
+			bitCapacity = 12
 		}
 	}
 
@@ -67,25 +92,182 @@ func CharacterCountBitCapacity(mode CharacterSet, version int) (bitCapacity int)
 }
 
 func CharacterCount(count int, mode CharacterSet, version int) Bits {
-	bitCapacity := CharacterCountBitCapacity(mode, version)
+	return toBits(count, CharacterCountBitCapacity(mode, version))
+}
 
+// Returns the lowest n bits of v, most significant first
+func toBits(v int, n int) Bits {
 	var out Bits
-	for i := bitCapacity - 1; i >= 0; i-- {
+	for i := n - 1; i >= 0; i-- {
 		// cursed masking
-		out = append(out, uint8((count&int(1<<i))>>i))
+		out = append(out, uint8((v&int(1<<i))>>i))
 	}
 
 	return out
 }
 
-func ConvertToNumeric(data []byte, version int) Bits {
+// Describes how segments are encoded in a particular type and version of symbol
+type dataFormat struct {
+	// The length of the mode indicators
+	modeBits int
+
+	// The mode indicator of each character set that can be used
+	modes map[CharacterSet]int
+
+	// The length of the character count of each character set
+	countBits map[CharacterSet]int
+
+	// The mode indicators that don't start a segment of characters, if there are any
+	specialModes map[int]specialMode
+
+	// The maximum length of the terminator
+	terminatorBits int
+}
+
+type specialMode int
+
+const (
+	eciMode specialMode = iota
+	structuredAppendMode
+	fnc1FirstMode
+	fnc1SecondMode
+)
+
+func qrDataFormat(version int) dataFormat {
+	f := dataFormat{
+		modeBits: 4,
+		modes: map[CharacterSet]int{
+			Numeric:      0b0001,
+			Alphanumeric: 0b0010,
+			Bytes:        0b0100,
+			Kanji:        0b1000,
+		},
+		countBits: make(map[CharacterSet]int),
+		specialModes: map[int]specialMode{
+			0b0111: eciMode,
+			0b0011: structuredAppendMode,
+			0b0101: fnc1FirstMode,
+			0b1001: fnc1SecondMode,
+		},
+		terminatorBits: 4,
+	}
+
+	for k := range f.modes {
+		f.countBits[k] = CharacterCountBitCapacity(k, version)
+	}
+
+	return f
+}
+
+// Returns the mode indicator of a special mode, or false if the format doesn't have it
+func (f dataFormat) specialModeIndicator(mode specialMode) (Bits, bool) {
+	for k, v := range f.specialModes {
+		if v == mode {
+			return toBits(k, f.modeBits), true
+		}
+	}
+
+	return nil, false
+}
+
+// Convert data into a segment of a symbol, with the mode indicator and character count
+func convertSegment(mode CharacterSet, data []byte, format dataFormat) (Bits, error) {
+	indicator, ok := format.modes[mode]
+	if !ok {
+		return nil, fmt.Errorf("%w: character set %v is not supported by this type of code", ErrUnsupportedMode, mode)
+	}
+
+	if err := checkCharacters(mode, data); err != nil {
+		return nil, err
+	}
+
 	var b Bits
 
 	// Add mode indicator
-	b = append(b, Bits{0, 0, 0, 1}...)
+	b = append(b, toBits(indicator, format.modeBits)...)
 
-	// Add character count
-	b = append(b, CharacterCount(len(data), Numeric, version)...)
+	// Add character count, then the data itself
+	switch mode {
+	case Numeric:
+		b = append(b, toBits(len(data), format.countBits[mode])...)
+		digits, err := numericBits(data)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, digits...)
+	case Alphanumeric:
+		b = append(b, toBits(len(data), format.countBits[mode])...)
+		b = append(b, alphanumericBits(data)...)
+	case Bytes:
+		b = append(b, toBits(len(data), format.countBits[mode])...)
+		b = append(b, byteBits(data)...)
+	case Kanji:
+		b = append(b, toBits(utf8.RuneCount(data), format.countBits[mode])...)
+		kanji, err := kanjiBits(data)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, kanji...)
+	}
+
+	return b, nil
+}
+
+// Returns an error if data has characters that can't be encoded in mode
+func checkCharacters(mode CharacterSet, data []byte) error {
+	switch mode {
+	case Numeric:
+		for _, v := range data {
+			if v < '0' || v > '9' {
+				return fmt.Errorf("%w: %q is not numeric", ErrInvalidCharacters, v)
+			}
+		}
+	case Alphanumeric:
+		for _, v := range data {
+			if _, ok := alphanumericTable[v]; !ok {
+				return fmt.Errorf("%w: %q is not alphanumeric", ErrInvalidCharacters, v)
+			}
+		}
+	case Bytes:
+	case Kanji:
+		if !utf8.Valid(data) {
+			return fmt.Errorf("%w: kanji must be utf-8", ErrInvalidCharacters)
+		}
+
+		for _, r := range string(data) {
+			if _, ok := shiftJISTable[r]; !ok {
+				return fmt.Errorf("%w: %q cannot be encoded in kanji mode", ErrInvalidCharacters, r)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown character set %v", ErrUnsupportedMode, mode)
+	}
+
+	return nil
+}
+
+// Returns ErrInvalidCharacters if data isn't all digits
+func ConvertToNumeric(data []byte, version int) (Bits, error) {
+	return convertSegment(Numeric, data, qrDataFormat(version))
+}
+
+// Returns ErrInvalidCharacters if data has characters outside the alphanumeric set
+func ConvertToAlphanumeric(data []byte, version int) (Bits, error) {
+	return convertSegment(Alphanumeric, data, qrDataFormat(version))
+}
+
+func ConvertToBytes(data []byte, version int) (Bits, error) {
+	return convertSegment(Bytes, data, qrDataFormat(version))
+}
+
+// Data should be passed as utf-8, and is converted to Shift JIS before encoding.
+// Returns ErrInvalidCharacters if a character isn't in Shift JIS
+func ConvertToKanji(data []byte, version int) (Bits, error) {
+	return convertSegment(Kanji, data, qrDataFormat(version))
+}
+
+func numericBits(data []byte) (Bits, error) {
+	var b Bits
 
 	// Divide into groups of three digits and convert to bits
 	for i := 0; i < len(data); i += 3 {
@@ -100,7 +282,7 @@ func ConvertToNumeric(data []byte, version int) Bits {
 		// Convert group
 		gi, err := strconv.Atoi(string(g))
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("%w: %q is not numeric", ErrInvalidCharacters, g)
 		}
 
 		// Small groups are encoded in less bits
@@ -117,18 +299,12 @@ func ConvertToNumeric(data []byte, version int) Bits {
 		}
 	}
 
-	return b
+	return b, nil
 }
 
-func ConvertToAlphanumeric(data []byte, version int) Bits {
+func alphanumericBits(data []byte) Bits {
 	var b Bits
 
-	// Add mode indicator
-	b = append(b, Bits{0, 0, 1, 0}...)
-
-	// Add character count
-	b = append(b, CharacterCount(len(data), Alphanumeric, version)...)
-
 	// Divide into groups of three digits and convert to bits
 	for i := 0; i < len(data); i += 2 {
 		// Group digits
@@ -163,15 +339,9 @@ func ConvertToAlphanumeric(data []byte, version int) Bits {
 	return b
 }
 
-func ConvertToBytes(data []byte, version int) Bits {
+func byteBits(data []byte) Bits {
 	var b Bits
 
-	// Add mode indicator
-	b = append(b, Bits{0, 1, 0, 0}...)
-
-	// Add character count
-	b = append(b, CharacterCount(len(data), Bytes, version)...)
-
 	// Convert each byte into bits
 	for _, v := range data {
 		for i := 7; i >= 0; i-- {
@@ -182,6 +352,36 @@ func ConvertToBytes(data []byte, version int) Bits {
 	return b
 }
 
+func kanjiBits(data []byte) (Bits, error) {
+	var b Bits
+
+	// Compact each double-byte character into 13 bits
+	for _, r := range string(data) {
+		c, ok := shiftJISTable[r]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q cannot be encoded in kanji mode", ErrInvalidCharacters, r)
+		}
+
+		// Subtract the offset of the range the character is in
+		var v int
+		if c <= 0x9FFC {
+			v = int(c) - 0x8140
+		} else {
+			v = int(c) - 0xC140
+		}
+
+		// Multiply the most significant byte by 0xC0 and add the least significant byte
+		v = (v>>8)*0xC0 + v&0xFF
+
+		// Add bits
+		for i := 12; i >= 0; i-- {
+			b = append(b, uint8((v&(1<<i))>>i))
+		}
+	}
+
+	return b, nil
+}
+
 // I love manually encoding tables into code by hand
 var alphanumericTable = map[byte]int{
 	'0': 0,
@@ -0,0 +1,64 @@
+package polishedqr
+
+import (
+	"errors"
+	"testing"
+)
+
+// Create codes with kanji, both on their own and mixed with other characters, and read them back
+func TestKanjiRoundTrip(t *testing.T) {
+	kanji := CharacterSet(Kanji)
+	for _, v := range []struct {
+		data         string
+		characterSet *CharacterSet
+	}{
+		{"漢字", &kanji},
+		{"こんにちは世界", &kanji},
+		{"点茗", nil},
+		{"価格は1234円です", nil},
+	} {
+		t.Run(v.data, func(t *testing.T) {
+			s, err := Create([]byte(v.data), &CreateOptions{CharacterSet: v.characterSet})
+			if err != nil {
+				t.Fatalf("error creating code: %v", err)
+			}
+
+			result := readSymbol(t, s, nil)
+			if string(result.Data) != v.data {
+				t.Fatalf("read %q, expected %q", result.Data, v.data)
+			}
+			if result.Segments[0].CharacterSet != Kanji {
+				t.Errorf("first segment is character set %v, expected kanji", result.Segments[0].CharacterSet)
+			}
+		})
+	}
+}
+
+// Characters that can't be encoded are returned as errors instead of panicking
+func TestConvertInvalidCharacters(t *testing.T) {
+	for _, v := range []struct {
+		name    string
+		convert func([]byte, int) (Bits, error)
+		data    string
+	}{
+		{"numeric", ConvertToNumeric, "12a4"},
+		{"alphanumeric", ConvertToAlphanumeric, "abc"},
+		{"kanji", ConvertToKanji, "漢字abc"},
+		{"kanji not utf-8", ConvertToKanji, "\x93\xfa"},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			if _, err := v.convert([]byte(v.data), 1); !errors.Is(err, ErrInvalidCharacters) {
+				t.Errorf("converting %q returned %v, expected %v", v.data, err, ErrInvalidCharacters)
+			}
+		})
+	}
+
+	// M1 codes only have numeric mode
+	if _, err := convertSegment(Bytes, []byte("abc"), microDataFormat(1)); !errors.Is(err, ErrUnsupportedMode) {
+		t.Errorf("converting bytes for M1 returned %v, expected %v", err, ErrUnsupportedMode)
+	}
+
+	if b, err := ConvertToNumeric([]byte("01234567"), 1); err != nil || len(b) != 4+10+27 {
+		t.Errorf("converting digits returned %v bits and %v, expected %v bits", len(b), err, 4+10+27)
+	}
+}
@@ -0,0 +1,44 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned when creating codes. They may be wrapped with more detail, so use errors.Is
+var (
+	// The data doesn't fit in the largest allowed symbol. Returned as a *DataTooLargeError
+	ErrDataTooLarge = errors.New("data too large")
+
+	// The error correction level isn't one of L, M, Q or H, or the type of code doesn't support it
+	ErrInvalidECLevel = errors.New("invalid error correction level")
+
+	// The data has characters that can't be encoded in the chosen character set or ECI assignment
+	ErrInvalidCharacters = errors.New("invalid characters")
+
+	// The version is outside the range of the type of code
+	ErrInvalidVersion = errors.New("invalid version")
+
+	// The character set or feature (such as ECI or GS1) isn't supported by the type or version of code
+	ErrUnsupportedMode = errors.New("unsupported mode")
+)
+
+// Describes data that doesn't fit, by comparing it to the capacity of the largest allowed symbol
+type DataTooLargeError struct {
+	// The number of data bits needed to encode the data
+	Required int
+
+	// The number of data bits in the largest allowed symbol
+	Available int
+
+	// The type of code, such as "qr code"
+	Symbol string
+}
+
+func (e *DataTooLargeError) Error() string {
+	return fmt.Sprintf("data too large: requires %v bits, but the largest allowed %v holds %v", e.Required, e.Symbol, e.Available)
+}
+
+func (e *DataTooLargeError) Unwrap() error {
+	return ErrDataTooLarge
+}
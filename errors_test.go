@@ -0,0 +1,82 @@
+package polishedqr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Each kind of invalid input is returned as its sentinel error
+func TestCreateErrors(t *testing.T) {
+	numeric := CharacterSet(Numeric)
+	eci := ECIUTF8
+	tooLarge := bytes.Repeat([]byte("a"), 3000)
+
+	for _, v := range []struct {
+		name     string
+		create   func() error
+		expected error
+	}{
+		{"data too large", func() error {
+			_, err := Create(tooLarge, nil)
+			return err
+		}, ErrDataTooLarge},
+		{"data too large for version", func() error {
+			_, err := Create([]byte("too large for version 1"), &CreateOptions{Version: 1, ErrorCorrectionLevel: "H"})
+			return err
+		}, ErrDataTooLarge},
+		{"structured append too large", func() error {
+			_, err := CreateStructuredAppendSymbols(tooLarge, &CreateOptions{Version: 5})
+			return err
+		}, ErrDataTooLarge},
+		{"invalid ec level", func() error {
+			_, err := Create([]byte("a"), &CreateOptions{ErrorCorrectionLevel: "X"})
+			return err
+		}, ErrInvalidECLevel},
+		{"micro ec level", func() error {
+			_, err := CreateMicro([]byte("1"), &CreateOptions{ErrorCorrectionLevel: "H"})
+			return err
+		}, ErrInvalidECLevel},
+		{"rmqr ec level", func() error {
+			_, err := CreateRMQR([]byte("1"), &CreateOptions{ErrorCorrectionLevel: "L"})
+			return err
+		}, ErrInvalidECLevel},
+		{"invalid characters", func() error {
+			_, err := Create([]byte("abc"), &CreateOptions{CharacterSet: &numeric})
+			return err
+		}, ErrInvalidCharacters},
+		{"invalid version", func() error {
+			_, err := Create([]byte("a"), &CreateOptions{Version: 41})
+			return err
+		}, ErrInvalidVersion},
+		{"micro version", func() error {
+			_, err := CreateMicro([]byte("1"), &CreateOptions{Version: 5})
+			return err
+		}, ErrInvalidVersion},
+		{"rmqr version", func() error {
+			_, err := CreateRMQR([]byte("1"), &CreateOptions{Version: 33})
+			return err
+		}, ErrInvalidVersion},
+		{"micro eci", func() error {
+			_, err := CreateMicro([]byte("1"), &CreateOptions{ECI: &eci})
+			return err
+		}, ErrUnsupportedMode},
+		{"M1 letters", func() error {
+			_, err := CreateMicro([]byte("ABC"), &CreateOptions{Version: 1})
+			return err
+		}, ErrUnsupportedMode},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			if err := v.create(); !errors.Is(err, v.expected) {
+				t.Errorf("returned %v, expected %v", err, v.expected)
+			}
+		})
+	}
+
+	// Data that is too large says how large it is
+	_, err := Create(tooLarge, nil)
+	var tooLargeErr *DataTooLargeError
+	if !errors.As(err, &tooLargeErr) || tooLargeErr.Required <= tooLargeErr.Available {
+		t.Errorf("returned %v, expected a *DataTooLargeError", err)
+	}
+}
@@ -0,0 +1,325 @@
+package polishedqr
+
+import (
+	"math"
+	"sort"
+)
+
+// A finder or alignment pattern found in an image
+type patternCandidate struct {
+	center     point
+	moduleSize float64
+
+	// The number of scan lines the pattern was found on
+	count int
+}
+
+var finderRatio = []float64{1, 1, 3, 1, 1}
+var alignmentRatio = []float64{1, 1, 1}
+
+// Returns the size of a module if the runs are in the ratio, or 0 if they aren't.
+// Each run may be off by up to half a module for every module in it.
+func matchRatio(runs []int, ratio []float64) float64 {
+	if len(runs) != len(ratio) {
+		return 0
+	}
+
+	var total int
+	var modules float64
+	for k, v := range runs {
+		if v == 0 {
+			return 0
+		}
+		total += v
+		modules += ratio[k]
+	}
+
+	moduleSize := float64(total) / modules
+	for k, v := range runs {
+		if math.Abs(float64(v)-ratio[k]*moduleSize) > ratio[k]*moduleSize/2 {
+			return 0
+		}
+	}
+
+	return moduleSize
+}
+
+// Count the runs of alternating colour on each side of c along d, starting with the run
+// that contains c, until n runs have been found on each side or maxLength pixels have been walked.
+// Returns the lengths of the runs in order, with the centre run counted once, and the middle of the centre run.
+func runsThrough(b *bitmap, c point, d point, n int, maxLength int) ([]int, point) {
+	walk := func(dir point) []int {
+		runs := make([]int, n)
+		colour := b.atPoint(c)
+		var run int
+		for k := 1; k <= maxLength; k++ {
+			dark := b.atPoint(c.add(dir.scale(float64(k))))
+			if dark != colour {
+				colour = dark
+				run++
+				if run == n {
+					break
+				}
+			}
+			runs[run]++
+		}
+
+		return runs
+	}
+
+	back := walk(d.scale(-1))
+	forward := walk(d)
+
+	var runs []int
+	for k := n - 1; k > 0; k-- {
+		runs = append(runs, back[k])
+	}
+	runs = append(runs, back[0]+forward[0]+1)
+	runs = append(runs, forward[1:]...)
+
+	return runs, c.add(d.scale(float64(forward[0]-back[0]) / 2))
+}
+
+// Returns the starting position and length of every run of the same colour in a row,
+// and whether the first run is dark
+func rowRuns(b *bitmap, y int) ([]int, []int, bool) {
+	starts := []int{0}
+	lengths := []int{0}
+	for x := 0; x < b.width; x++ {
+		if x > 0 && b.at(x, y) != b.at(x-1, y) {
+			starts = append(starts, x)
+			lengths = append(lengths, 0)
+		}
+		lengths[len(lengths)-1]++
+	}
+
+	return starts, lengths, b.at(0, y)
+}
+
+// Add a pattern to the candidates, merging it with a candidate that it is a copy of
+func addCandidate(candidates []patternCandidate, c point, moduleSize float64) []patternCandidate {
+	for k, v := range candidates {
+		if v.center.dist(c) < v.moduleSize*2 && math.Abs(v.moduleSize-moduleSize) < v.moduleSize/2 {
+			// Average the positions of every copy
+			n := float64(v.count)
+			candidates[k].center = v.center.scale(n).add(c).scale(1 / (n + 1))
+			candidates[k].moduleSize = (v.moduleSize*n + moduleSize) / (n + 1)
+			candidates[k].count++
+			return candidates
+		}
+	}
+
+	return append(candidates, patternCandidate{center: c, moduleSize: moduleSize, count: 1})
+}
+
+// Check that there is a finder pattern centred around c, across every direction.
+// Returns the refined centre and the size of a module
+func crossCheckFinder(b *bitmap, c point, moduleSize float64) (point, float64, bool) {
+	maxLength := int(moduleSize*7) + 2
+
+	// Vertically, then horizontally again to refine the centre
+	runs, c := runsThrough(b, c, point{0, 1}, 3, maxLength)
+	vertical := matchRatio(runs, finderRatio)
+	if vertical == 0 {
+		return point{}, 0, false
+	}
+
+	runs, c = runsThrough(b, c, point{1, 0}, 3, maxLength)
+	horizontal := matchRatio(runs, finderRatio)
+	if horizontal == 0 {
+		return point{}, 0, false
+	}
+
+	// The diagonals rule out most patterns in the data
+	runs, _ = runsThrough(b, c, point{1, 1}, 3, maxLength)
+	if matchRatio(runs, finderRatio) == 0 {
+		return point{}, 0, false
+	}
+
+	runs, _ = runsThrough(b, c, point{1, -1}, 3, maxLength)
+	if matchRatio(runs, finderRatio) == 0 {
+		return point{}, 0, false
+	}
+
+	return c, (vertical + horizontal) / 2, true
+}
+
+// Scan every row for runs in the ratio 1:1:3:1:1 (dark, light, dark, light, dark),
+// and return the finder patterns that they belong to, most often found first
+func findFinderPatterns(b *bitmap) []patternCandidate {
+	var candidates []patternCandidate
+	for y := 0; y < b.height; y++ {
+		starts, lengths, dark := rowRuns(b, y)
+
+		// Start from the first dark run
+		first := 0
+		if !dark {
+			first = 1
+		}
+
+		for k := first; k+4 < len(lengths); k += 2 {
+			moduleSize := matchRatio(lengths[k:k+5], finderRatio)
+			if moduleSize == 0 {
+				continue
+			}
+
+			centre := point{float64(starts[k+2]) + float64(lengths[k+2])/2, float64(y) + 0.5}
+			centre, moduleSize, ok := crossCheckFinder(b, centre, moduleSize)
+			if ok {
+				candidates = addCandidate(candidates, centre, moduleSize)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].count > candidates[j].count
+	})
+
+	return candidates
+}
+
+// The most finder patterns that are grouped into triples. The number of triples grows with the cube
+// of the number of patterns, so only the ones found most often are used
+const maxFinderCandidates = 60
+
+// Group finder patterns into triples that could be the corners of a qr code, best first.
+// Each triple is in the order top left, top right, bottom left
+func finderTriples(candidates []patternCandidate) [][3]patternCandidate {
+	type triple struct {
+		finders [3]patternCandidate
+		score   float64
+	}
+
+	if len(candidates) > maxFinderCandidates {
+		candidates = candidates[:maxFinderCandidates]
+	}
+
+	var triples []triple
+	for i := 0; i < len(candidates); i++ {
+		for j := i + 1; j < len(candidates); j++ {
+			for k := j + 1; k < len(candidates); k++ {
+				a, b, c := candidates[i], candidates[j], candidates[k]
+
+				// The modules of every pattern should be about the same size
+				minSize := math.Min(a.moduleSize, math.Min(b.moduleSize, c.moduleSize))
+				maxSize := math.Max(a.moduleSize, math.Max(b.moduleSize, c.moduleSize))
+				if maxSize > minSize*1.5 {
+					continue
+				}
+
+				// Put the corner opposite the longest side first
+				ab, bc, ca := a.center.dist(b.center), b.center.dist(c.center), c.center.dist(a.center)
+				if ab > bc && ab > ca {
+					a, c = c, a
+					bc, ab = ab, bc
+				} else if ca > bc {
+					a, b = b, a
+					bc, ca = ca, bc
+				}
+
+				// Finder patterns are at least 14 modules apart, although modules look
+				// up to 1.4 times wider along the rows of the image when the code is rotated.
+				// The finder patterns of the largest codes are 170 modules apart, so allow a little more than that
+				if ab < minSize*10 || ca < minSize*10 || ab > maxSize*174 || ca > maxSize*174 {
+					continue
+				}
+
+				// The other two corners should be equally far away, at a right angle
+				score := math.Abs(ab-ca)/math.Max(ab, ca) + math.Abs(bc-math.Hypot(ab, ca))/bc
+				if score > 0.3 {
+					continue
+				}
+
+				// Prefer patterns with the same size of module
+				score += (maxSize - minSize) / maxSize
+
+				// Find the z coordinate of the cross product to work out which is top right
+				l2 := b.center.sub(a.center)
+				l3 := c.center.sub(a.center)
+				if l2.x*l3.y-l2.y*l3.x < 0 {
+					b, c = c, b
+				}
+
+				triples = append(triples, triple{[3]patternCandidate{a, b, c}, score})
+			}
+		}
+	}
+
+	sort.SliceStable(triples, func(i, j int) bool {
+		return triples[i].score < triples[j].score
+	})
+
+	var out [][3]patternCandidate
+	for _, v := range triples {
+		out = append(out, v.finders)
+	}
+
+	return out
+}
+
+// Search around the expected centre of an alignment pattern, searching further away if it isn't found.
+// xAxis and yAxis are the size and direction of a module near the pattern.
+// Returns the centre of the pattern closest to where it was expected
+func findAlignmentPattern(b *bitmap, expected point, xAxis, yAxis point) (point, bool) {
+	moduleSize := (math.Hypot(xAxis.x, xAxis.y) + math.Hypot(yAxis.x, yAxis.y)) / 2
+	maxLength := int(moduleSize*2.5) + 1
+
+	for _, allowance := range []float64{4, 8, 16} {
+		r := allowance * moduleSize
+		var best point
+		bestDist := math.Inf(1)
+
+		for y := int(expected.y - r); y <= int(expected.y+r); y++ {
+			for x := int(expected.x - r); x <= int(expected.x+r); x++ {
+				// Look for the centre module, which is dark with light on either side
+				if !b.at(x, y) || b.at(x-1, y) {
+					continue
+				}
+
+				c := point{float64(x) + 0.5, float64(y) + 0.5}
+				runs, c := runsThrough(b, c, point{1, 0}, 3, maxLength)
+				if matchRatio(runs[1:4], alignmentRatio) == 0 {
+					continue
+				}
+
+				runs, c = runsThrough(b, c, point{0, 1}, 3, maxLength)
+				if matchRatio(runs[1:4], alignmentRatio) == 0 {
+					continue
+				}
+
+				// Patterns in the data can look like this along a line, so check every module
+				if !isAlignmentPattern(b, c, xAxis, yAxis) {
+					continue
+				}
+
+				if d := c.dist(expected); d < bestDist {
+					bestDist = d
+					best = c
+				}
+			}
+		}
+
+		if !math.IsInf(bestDist, 1) {
+			return best, true
+		}
+	}
+
+	return point{}, false
+}
+
+// Returns true if the 5x5 modules around c look like an alignment pattern,
+// with at most one module wrong
+func isAlignmentPattern(b *bitmap, c point, xAxis, yAxis point) bool {
+	var wrong int
+	for y := -2; y <= 2; y++ {
+		for x := -2; x <= 2; x++ {
+			// The outer ring and the centre are dark
+			dark := x == -2 || x == 2 || y == -2 || y == 2 || (x == 0 && y == 0)
+			if b.atPoint(c.add(xAxis.scale(float64(x))).add(yAxis.scale(float64(y)))) != dark {
+				wrong++
+			}
+		}
+	}
+
+	return wrong <= 1
+}
@@ -0,0 +1,375 @@
+package polishedqr
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// A print quality grade, from A (the best) down to F
+type QualityGrade int
+
+const (
+	GradeF QualityGrade = iota
+	GradeD
+	GradeC
+	GradeB
+	GradeA
+)
+
+func (g QualityGrade) String() string {
+	if g < GradeF || g > GradeA {
+		return "?"
+	}
+
+	return string("FDCBA"[g])
+}
+
+// A measured quality parameter, and the grade it earned
+type GradedValue struct {
+	Value float64
+	Grade QualityGrade
+}
+
+// The print quality of a symbol, graded in the style of ISO/IEC 15415.
+// Reflectances are measured from the image as it is, so grades are only as good as the scan.
+type QualityReport struct {
+	// The symbol that was graded
+	Result QRCodeResult
+
+	// The difference between the highest and lowest reflectance in the symbol and its quiet zone, from 0 to 1
+	SymbolContrast GradedValue
+
+	// The lowest modulation of any data module, which is how far its reflectance is from the threshold,
+	// compared to the symbol contrast. It is graded together with the unused error correction, so a
+	// few poor modules don't lower the grade much
+	Modulation GradedValue
+
+	// Like modulation, but modules that are on the wrong side of the threshold count as 0
+	ReflectanceMargin GradedValue
+
+	// The number of modules of the finder patterns, separators and timing patterns that are the wrong colour
+	FixedPatternDamage GradedValue
+
+	// How much the spacing of modules differs between the two axes, as a fraction of the average
+	AxialNonUniformity GradedValue
+
+	// The largest distance between an alignment pattern and where it would be on a perfect grid, in modules
+	GridNonUniformity GradedValue
+
+	// The fraction of error correction left over in the worst block, without using erasures
+	UnusedErrorCorrection GradedValue
+
+	// The lowest grade of any parameter
+	Overall QualityGrade
+}
+
+// Grade the print quality of the qr code in a scanned image
+func Grade(img image.Image) (QualityReport, error) {
+	results, b, err := readImage(img, nil, 1)
+	if err != nil {
+		return QualityReport{}, err
+	}
+
+	result := results[0]
+	if result.Micro {
+		return QualityReport{}, errors.New("grading micro qr codes isn't supported")
+	}
+
+	version, ecLevel, mask := result.Version, result.ErrorCorrectionLevel, result.Mask
+	transform := result.Location.Homography
+	dim := version*4 + 17
+
+	// Read the codewords again, without erasures
+	s := sampleSymbol(b, transform, dim, dim)
+	s.Function = newQRSymbol(version).Function
+	var quality DecodeQuality
+	datawords, err := correctDataWords(readCodewords(s, mask), nil, version, ecLevel, &quality)
+	if err != nil {
+		return QualityReport{}, err
+	}
+
+	// Draw the symbol as it should have been printed
+	ideal := newQRSymbol(version)
+	writeData(ideal, generateErrorWords(datawords, version, ecLevel))
+	applyMask(ideal, Masks[mask])
+	addFormatAndVersionInfo(ideal, ecLevel, mask, version)
+
+	report := QualityReport{Result: result}
+
+	// Measure the reflectance of every module, and the quiet zone just around the symbol
+	reflectance := make([][]float64, dim)
+	for y := range reflectance {
+		reflectance[y] = make([]float64, dim)
+	}
+
+	rMin, rMax := 1.0, 0.0
+	for y := -1; y <= dim; y++ {
+		for x := -1; x <= dim; x++ {
+			r, ok := moduleReflectance(b, transform, x, y)
+			if !ok {
+				continue
+			}
+
+			rMin = math.Min(rMin, r)
+			rMax = math.Max(rMax, r)
+			if x >= 0 && y >= 0 && x < dim && y < dim {
+				reflectance[y][x] = r
+			}
+		}
+	}
+
+	contrast := rMax - rMin
+	threshold := (rMax + rMin) / 2
+
+	// Whether a module looks dark, which is the other way around for inverted codes
+	looksDark := func(x, y int) bool {
+		return (reflectance[y][x] < threshold) != result.Inverted
+	}
+	report.SymbolContrast = GradedValue{contrast, gradeAbove(contrast, 0.70, 0.55, 0.40, 0.20)}
+
+	// Find the modulation and reflectance margin of every module
+	modulation := make([][]float64, dim)
+	margin := make([][]float64, dim)
+	for y := range modulation {
+		modulation[y] = make([]float64, dim)
+		margin[y] = make([]float64, dim)
+	}
+
+	iterateRect(dim, dim, func(x, y int) {
+		if contrast > 0 {
+			modulation[y][x] = math.Min(1, 2*math.Abs(reflectance[y][x]-threshold)/contrast)
+		}
+		if looksDark(x, y) == ideal.Dark(x, y) {
+			margin[y][x] = modulation[y][x]
+		}
+	})
+
+	// Codewords that were read wrong use twice as much error correction as erasures
+	table := codeWordTable[version][ecLevel]
+	allwords := generateErrorWords(datawords, version, ecLevel)
+	wrong := make([]bool, len(allwords))
+	for k, v := range readCodewords(s, mask) {
+		if k < len(wrong) {
+			wrong[k] = v != allwords[k]
+		}
+	}
+
+	report.Modulation = gradeCodewords(s, modulation, wrong, table)
+	report.ReflectanceMargin = gradeCodewords(s, margin, wrong, table)
+
+	// Count the damaged modules in each finder pattern with its separator, and in the timing patterns
+	report.FixedPatternDamage = gradeFixedPatterns(ideal, looksDark)
+
+	// Compare the spacing of the modules along each side of the symbol
+	corners := result.Location.Corners
+	side := func(a, b image.Point) float64 {
+		return math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+	}
+	xAvg := (side(corners[0], corners[1]) + side(corners[3], corners[2])) / 2 / float64(dim)
+	yAvg := (side(corners[0], corners[3]) + side(corners[1], corners[2])) / 2 / float64(dim)
+	axial := math.Abs(xAvg-yAvg) / ((xAvg + yAvg) / 2)
+	report.AxialNonUniformity = GradedValue{axial, gradeBelow(axial, 0.06, 0.08, 0.10, 0.12)}
+
+	grid := gridNonUniformity(b, transform, version)
+	report.GridNonUniformity = GradedValue{grid, gradeBelow(grid, 0.38, 0.50, 0.63, 0.75)}
+
+	// Unused error correction, in the worst block
+	unused := 1.0
+	for _, v := range quality.CorrectedCodewords {
+		unused = math.Min(unused, 1-float64(v*2)/float64(table.ecWordsPerBlock))
+	}
+	report.UnusedErrorCorrection = GradedValue{unused, gradeAbove(unused, 0.62, 0.50, 0.37, 0.25)}
+
+	report.Overall = GradeA
+	for _, v := range []GradedValue{
+		report.SymbolContrast, report.Modulation, report.ReflectanceMargin, report.FixedPatternDamage,
+		report.AxialNonUniformity, report.GridNonUniformity, report.UnusedErrorCorrection,
+	} {
+		if v.Grade < report.Overall {
+			report.Overall = v.Grade
+		}
+	}
+
+	return report, nil
+}
+
+// Returns the average reflectance around the centre of a module, or false if it is outside of the image
+func moduleReflectance(b *bitmap, transform Homography, x, y int) (float64, bool) {
+	var total float64
+	for _, d := range []point{{0, 0}, {-0.3, 0}, {0.3, 0}, {0, -0.3}, {0, 0.3}} {
+		r, ok := b.reflectanceAt(transform.transform(point{float64(x) + 0.5 + d.x, float64(y) + 0.5 + d.y}))
+		if !ok {
+			return 0, false
+		}
+		total += r
+	}
+
+	return total / 5, true
+}
+
+// Returns the grade for a value where higher is better, given the lowest value for grades A to D
+func gradeAbove(v float64, a, b, c, d float64) QualityGrade {
+	for k, limit := range []float64{a, b, c, d} {
+		if v >= limit {
+			return GradeA - QualityGrade(k)
+		}
+	}
+
+	return GradeF
+}
+
+// Returns the grade for a value where lower is better, given the highest value for grades A to D
+func gradeBelow(v float64, a, b, c, d float64) QualityGrade {
+	for k, limit := range []float64{a, b, c, d} {
+		if v <= limit {
+			return GradeA - QualityGrade(k)
+		}
+	}
+
+	return GradeF
+}
+
+// Returns the block that each codeword belongs to, in the order they are placed in the symbol
+func codewordBlocks(table ecBlocks) []int {
+	var dataCounts []int
+	for _, blockType := range table.blocks {
+		for i := 0; i < blockType.count; i++ {
+			dataCounts = append(dataCounts, blockType.dataWords)
+		}
+	}
+
+	var blocks []int
+	for i := 0; i < dataCounts[len(dataCounts)-1]; i++ {
+		for k, v := range dataCounts {
+			if i < v {
+				blocks = append(blocks, k)
+			}
+		}
+	}
+	for i := 0; i < table.ecWordsPerBlock; i++ {
+		for k := range dataCounts {
+			blocks = append(blocks, k)
+		}
+	}
+
+	return blocks
+}
+
+// Grade a per module value (modulation or reflectance margin) by codeword, taking error correction into account.
+// Each codeword gets the grade of its worst module. Then, at each grade, codewords below it are treated as
+// erasures, and the grade is limited by how much error correction that leaves. The best of these is the result
+func gradeCodewords(s *Symbol, values [][]float64, wrong []bool, table ecBlocks) GradedValue {
+	blocks := codewordBlocks(table)
+	lowest := 1.0
+	codewordGrades := make([]QualityGrade, len(blocks))
+	for k := range codewordGrades {
+		codewordGrades[k] = GradeA
+	}
+
+	var i int
+	zigZag(s, 6, func(x, y int) {
+		lowest = math.Min(lowest, values[y][x])
+		if i/8 < len(codewordGrades) {
+			g := gradeAbove(values[y][x], 0.50, 0.40, 0.30, 0.20)
+			if g < codewordGrades[i/8] {
+				codewordGrades[i/8] = g
+			}
+		}
+		i++
+	})
+
+	var blockCount int
+	for _, v := range table.blocks {
+		blockCount += v.count
+	}
+
+	best := GradeF
+	for level := GradeA; level > GradeF; level-- {
+		used := make([]int, blockCount)
+		for k, block := range blocks {
+			if wrong[k] {
+				used[block] += 2
+			} else if codewordGrades[k] < level {
+				used[block]++
+			}
+		}
+
+		grade := level
+		for _, v := range used {
+			unused := 1 - float64(v)/float64(table.ecWordsPerBlock)
+			if g := gradeAbove(unused, 0.62, 0.50, 0.37, 0.25); g < grade {
+				grade = g
+			}
+		}
+
+		if grade > best {
+			best = grade
+		}
+	}
+
+	return GradedValue{lowest, best}
+}
+
+// Grade the finder patterns with their separators, and the timing patterns,
+// by how many of their modules are the wrong colour. dark reports the measured colour of a module
+func gradeFixedPatterns(ideal *Symbol, dark func(x, y int) bool) GradedValue {
+	dim := ideal.Width()
+	var damaged int
+	grade := GradeA
+
+	// Finder patterns and separators, where each wrong module lowers the grade
+	for _, corner := range [][2]int{{0, 0}, {dim - 8, 0}, {0, dim - 8}} {
+		var wrong int
+		iterateRect(8, 8, func(x, y int) {
+			if dark(corner[0]+x, corner[1]+y) != ideal.Dark(corner[0]+x, corner[1]+y) {
+				wrong++
+			}
+		})
+
+		damaged += wrong
+		if g := GradeA - QualityGrade(math.Min(float64(wrong), 4)); g < grade {
+			grade = g
+		}
+	}
+
+	// Timing patterns, graded by the fraction of wrong modules
+	var wrong, total int
+	for i := 8; i < dim-8; i++ {
+		for _, p := range [][2]int{{i, 6}, {6, i}} {
+			if dark(p[0], p[1]) != ideal.Dark(p[0], p[1]) {
+				wrong++
+			}
+			total++
+		}
+	}
+
+	damaged += wrong
+	if g := gradeBelow(float64(wrong)/float64(total), 0, 0.07, 0.11, 0.15); g < grade {
+		grade = g
+	}
+
+	return GradedValue{float64(damaged), grade}
+}
+
+// Returns the largest distance, in modules, between an alignment pattern and where it would be
+// on a perfect grid through the finder patterns
+func gridNonUniformity(b *bitmap, transform Homography, version int) float64 {
+	dim := float64(version*4 + 17)
+	topLeft := transform.transform(point{3.5, 3.5})
+	xAxis := transform.transform(point{dim - 3.5, 3.5}).sub(topLeft).scale(1 / (dim - 7))
+	yAxis := transform.transform(point{3.5, dim - 3.5}).sub(topLeft).scale(1 / (dim - 7))
+	grid := affineHomography(topLeft.sub(xAxis.scale(3.5)).sub(yAxis.scale(3.5)), xAxis, yAxis)
+	moduleSize := (math.Hypot(xAxis.x, xAxis.y) + math.Hypot(yAxis.x, yAxis.y)) / 2
+
+	var worst float64
+	for _, v := range getAlignmentPositions(version) {
+		c := point{float64(v[0]) + 0.5, float64(v[1]) + 0.5}
+		expected := transform.transform(c)
+		if align, ok := findAlignmentPattern(b, expected, xAxis, yAxis); ok {
+			worst = math.Max(worst, align.dist(grid.transform(c))/moduleSize)
+		}
+	}
+
+	return worst
+}
@@ -0,0 +1,161 @@
+package polishedqr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// The group separator, which ends variable length fields in GS1 data
+const gs1Separator = 0x1D
+
+type ApplicationIdentifier struct {
+	// The digits of the application identifier, such as "01"
+	AI    string
+	Value string
+}
+
+// The number of digits in an application identifier, by its first two digits
+var gs1AILengths = map[string]int{
+	"00": 2, "01": 2, "02": 2, "03": 2, "04": 2,
+	"10": 2, "11": 2, "12": 2, "13": 2, "14": 2, "15": 2, "16": 2, "17": 2, "18": 2, "19": 2,
+	"20": 2, "21": 2, "22": 2, "23": 3, "24": 3, "25": 3,
+	"30": 2, "31": 4, "32": 4, "33": 4, "34": 4, "35": 4, "36": 4, "37": 2, "39": 4,
+	"40": 3, "41": 3, "42": 3, "43": 4,
+	"70": 4, "71": 3, "72": 4,
+	"80": 4, "81": 4, "82": 4,
+	"90": 2, "91": 2, "92": 2, "93": 2, "94": 2, "95": 2, "96": 2, "97": 2, "98": 2, "99": 2,
+}
+
+// The length of the values of application identifiers that are always fixed length,
+// by their first two digits. These never need a separator after them.
+var gs1FixedLengths = map[string]int{
+	"00": 18, "01": 14, "02": 14, "03": 14, "04": 16,
+	"11": 6, "12": 6, "13": 6, "14": 6, "15": 6, "16": 6, "17": 6, "18": 6, "19": 6,
+	"20": 2,
+	"31": 6, "32": 6, "33": 6, "34": 6, "35": 6, "36": 6,
+	"41": 13,
+}
+
+var gs1InputRE = regexp.MustCompile(`\((\d{2,4})\)([^(]*)`)
+
+// Convert human readable GS1 data, such as (01)09501101530008(17)260101,
+// into an element string with separators after variable length fields
+func parseGS1Input(data []byte) ([]byte, error) {
+	matches := gs1InputRE.FindAllSubmatchIndex(data, -1)
+	if len(matches) == 0 || matches[0][0] != 0 {
+		return nil, errors.New("gs1 data must start with a bracketed application identifier")
+	}
+
+	var out []byte
+	for k, v := range matches {
+		if k > 0 && matches[k-1][1] != v[0] {
+			return nil, errors.New("invalid gs1 data")
+		}
+
+		ai := string(data[v[2]:v[3]])
+		value := data[v[4]:v[5]]
+		if len(value) == 0 {
+			return nil, fmt.Errorf("application identifier %v has no value", ai)
+		}
+
+		if l, ok := gs1AILengths[ai[:2]]; ok && l != len(ai) {
+			return nil, fmt.Errorf("application identifier %v should be %v digits", ai, l)
+		}
+
+		l, fixed := gs1FixedLengths[ai[:2]]
+		if fixed && l != len(value) {
+			return nil, fmt.Errorf("application identifier %v should have a value of %v characters", ai, l)
+		}
+
+		out = append(out, ai...)
+		out = append(out, value...)
+		if !fixed && k != len(matches)-1 {
+			out = append(out, gs1Separator)
+		}
+	}
+
+	if matches[len(matches)-1][1] != len(data) {
+		return nil, errors.New("invalid gs1 data")
+	}
+
+	return out, nil
+}
+
+// Split a GS1 element string into its fields
+func parseGS1ElementString(data []byte) ([]ApplicationIdentifier, error) {
+	var out []ApplicationIdentifier
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("gs1 data ended unexpectedly")
+		}
+
+		aiLength, ok := gs1AILengths[string(data[:2])]
+		if !ok {
+			return nil, fmt.Errorf("unknown application identifier %v", string(data[:2]))
+		}
+		if len(data) < aiLength {
+			return nil, errors.New("gs1 data ended unexpectedly")
+		}
+		ai := string(data[:aiLength])
+		data = data[aiLength:]
+
+		// Fixed length fields end after their value, others end at the separator
+		var value []byte
+		if l, ok := gs1FixedLengths[ai[:2]]; ok {
+			if len(data) < l {
+				return nil, errors.New("gs1 data ended unexpectedly")
+			}
+			value = data[:l]
+			data = data[l:]
+		} else if end := bytes.IndexByte(data, gs1Separator); end >= 0 {
+			value = data[:end]
+			data = data[end:]
+		} else {
+			value = data
+			data = nil
+		}
+
+		// Separators may also follow fixed length fields
+		if len(data) > 0 && data[0] == gs1Separator {
+			data = data[1:]
+		}
+
+		out = append(out, ApplicationIdentifier{AI: ai, Value: string(value)})
+	}
+
+	return out, nil
+}
+
+// In FNC1 mode, alphanumeric segments use % as the separator and %% as a literal %
+func escapeFNC1(data []byte) []byte {
+	var out []byte
+	for _, v := range data {
+		if v == gs1Separator {
+			out = append(out, '%')
+		} else if v == '%' {
+			out = append(out, '%', '%')
+		} else {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func unescapeFNC1(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); i++ {
+		if data[i] != '%' {
+			out = append(out, data[i])
+		} else if i+1 < len(data) && data[i+1] == '%' {
+			out = append(out, '%')
+			i++
+		} else {
+			out = append(out, gs1Separator)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,54 @@
+package polishedqr
+
+import "testing"
+
+// Create GS1 codes and read them back, checking the element string and its fields
+func TestGS1RoundTrip(t *testing.T) {
+	for _, v := range []struct {
+		input       string
+		elements    string
+		identifiers []ApplicationIdentifier
+	}{
+		{
+			"(01)09501101530008(17)260101",
+			"010950110153000817260101",
+			[]ApplicationIdentifier{{"01", "09501101530008"}, {"17", "260101"}},
+		},
+		{
+			// Variable length fields are ended with a separator, and % has to be escaped
+			"(10)ABC-123(21)50%OFF(01)09501101530008",
+			"10ABC-123\x1d2150%OFF\x1d0109501101530008",
+			[]ApplicationIdentifier{{"10", "ABC-123"}, {"21", "50%OFF"}, {"01", "09501101530008"}},
+		},
+	} {
+		t.Run(v.input, func(t *testing.T) {
+			s, err := Create([]byte(v.input), &CreateOptions{GS1: true})
+			if err != nil {
+				t.Fatalf("error creating code: %v", err)
+			}
+
+			result := readSymbol(t, s, nil)
+			if !result.GS1 {
+				t.Errorf("code wasn't read as gs1")
+			}
+			if string(result.Data) != v.elements {
+				t.Fatalf("read %q, expected %q", result.Data, v.elements)
+			}
+
+			if len(result.ApplicationIdentifiers) != len(v.identifiers) {
+				t.Fatalf("read %v, expected %v", result.ApplicationIdentifiers, v.identifiers)
+			}
+			for k := range v.identifiers {
+				if result.ApplicationIdentifiers[k] != v.identifiers[k] {
+					t.Errorf("read %v, expected %v", result.ApplicationIdentifiers, v.identifiers)
+				}
+			}
+		})
+	}
+
+	for _, v := range []string{"01)09501101530008", "(01)0950110153", "(01)"} {
+		if _, err := Create([]byte(v), &CreateOptions{GS1: true}); err == nil {
+			t.Errorf("created gs1 code from invalid data %q", v)
+		}
+	}
+}
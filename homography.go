@@ -0,0 +1,115 @@
+package polishedqr
+
+import "math"
+
+// A point in an image, in pixels. Pixel (x,y) covers the area from (x,y) to (x+1,y+1)
+type point struct {
+	x float64
+	y float64
+}
+
+func (p point) add(q point) point {
+	return point{p.x + q.x, p.y + q.y}
+}
+
+func (p point) sub(q point) point {
+	return point{p.x - q.x, p.y - q.y}
+}
+
+func (p point) scale(f float64) point {
+	return point{p.x * f, p.y * f}
+}
+
+func (p point) dist(q point) float64 {
+	return math.Hypot(p.x-q.x, p.y-q.y)
+}
+
+// A perspective transform between two planes, stored as a 3x3 matrix in row-major order.
+// When reading codes, it maps module coordinates onto pixels, where (0,0) is the
+// top left corner of the code (without the quiet zone) and the centre of module (x,y) is (x+0.5,y+0.5)
+type Homography [9]float64
+
+// Returns the transform that maps the 4 src points onto the 4 dst points
+func newHomography(src, dst [4]point) Homography {
+	return squareToQuad(dst).mul(squareToQuad(src).adjugate())
+}
+
+// Returns the transform that maps the unit square onto a quadrilateral,
+// with (0,0), (1,0), (0,1) and (1,1) going to each point in order
+func squareToQuad(q [4]point) Homography {
+	dx1 := q[1].x - q[3].x
+	dx2 := q[2].x - q[3].x
+	dx3 := q[0].x - q[1].x - q[2].x + q[3].x
+	dy1 := q[1].y - q[3].y
+	dy2 := q[2].y - q[3].y
+	dy3 := q[0].y - q[1].y - q[2].y + q[3].y
+
+	// Solve for the perspective terms, which are zero when the quadrilateral is a parallelogram
+	denominator := dx1*dy2 - dx2*dy1
+	g := (dx3*dy2 - dx2*dy3) / denominator
+	h := (dx1*dy3 - dx3*dy1) / denominator
+
+	return Homography{
+		q[1].x - q[0].x + g*q[1].x, q[2].x - q[0].x + h*q[2].x, q[0].x,
+		q[1].y - q[0].y + g*q[1].y, q[2].y - q[0].y + h*q[2].y, q[0].y,
+		g, h, 1,
+	}
+}
+
+// Returns the transform that maps (0,0) onto origin, and moves by xAxis and yAxis
+// for every step along x and y
+func affineHomography(origin, xAxis, yAxis point) Homography {
+	return Homography{
+		xAxis.x, yAxis.x, origin.x,
+		xAxis.y, yAxis.y, origin.y,
+		0, 0, 1,
+	}
+}
+
+// The adjugate of the matrix, which is the inverse up to scale.
+// That is all a Homography needs, because the result is divided through by w
+func (m Homography) adjugate() Homography {
+	return Homography{
+		m[4]*m[8] - m[5]*m[7], m[2]*m[7] - m[1]*m[8], m[1]*m[5] - m[2]*m[4],
+		m[5]*m[6] - m[3]*m[8], m[0]*m[8] - m[2]*m[6], m[2]*m[3] - m[0]*m[5],
+		m[3]*m[7] - m[4]*m[6], m[1]*m[6] - m[0]*m[7], m[0]*m[4] - m[1]*m[3],
+	}
+}
+
+// Returns the transform that applies n and then m
+func (m Homography) mul(n Homography) Homography {
+	var out Homography
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			for k := 0; k < 3; k++ {
+				out[r*3+c] += m[r*3+k] * n[k*3+c]
+			}
+		}
+	}
+
+	return out
+}
+
+// Map a point through the transform
+func (m Homography) Transform(x, y float64) (float64, float64) {
+	p := m.transform(point{x, y})
+	return p.x, p.y
+}
+
+// Returns the transform that maps points back, such as from pixels onto modules
+func (m Homography) Inverse() Homography {
+	inv := m.adjugate()
+	for k := range inv {
+		inv[k] /= inv[8]
+	}
+
+	return inv
+}
+
+func (m Homography) transform(p point) point {
+	w := m[6]*p.x + m[7]*p.y + m[8]
+	return point{
+		(m[0]*p.x + m[1]*p.y + m[2]) / w,
+		(m[3]*p.x + m[4]*p.y + m[5]) / w,
+	}
+}
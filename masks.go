@@ -1,11 +1,6 @@
 package polishedqr
 
-import (
-	"image"
-	"image/color"
-	"image/draw"
-	"math"
-)
+import "math"
 
 var Masks = []func(int, int) bool{mask1, mask2, mask3, mask4, mask5, mask6, mask7, mask8}
 
@@ -34,13 +29,12 @@ func mask8(x, y int) bool {
 	return (((x+y)%2)+((x*y)%3))%2 == 0
 }
 
-func applyBestMask(img *image.RGBA, ecLevel string, version int) int {
+func applyBestMask(s *Symbol, ecLevel string, version int) int {
 	lowestPenalty := math.MaxInt
 	bestMask := 0
 	for k, v := range Masks {
-		// Make a copy of the image
-		masked := image.NewRGBA(img.Rect)
-		draw.Draw(masked, img.Rect, img, image.Pt(0, 0), draw.Over)
+		// Make a copy of the symbol
+		masked := s.copy()
 
 		// Add format info
 		addFormatAndVersionInfo(masked, ecLevel, k, version)
@@ -56,41 +50,29 @@ func applyBestMask(img *image.RGBA, ecLevel string, version int) int {
 		}
 	}
 
-	applyMask(img, Masks[bestMask])
+	applyMask(s, Masks[bestMask])
 
 	return bestMask
 }
 
-func applyMask(img *image.RGBA, mask func(int, int) bool) {
-	for x := 0; x < img.Rect.Dx(); x++ {
-		for y := 0; y < img.Rect.Dy(); y++ {
-			if mask(x, y) {
-				// Flip it
-				if img.RGBAAt(x, y) == GREEN {
-					img.Set(x, y, WHITE)
-				} else if img.RGBAAt(x, y) == RED {
-					img.Set(x, y, BLACK)
-				}
-			} else {
-				if img.RGBAAt(x, y) == RED {
-					img.Set(x, y, WHITE)
-				} else if img.RGBAAt(x, y) == GREEN {
-					img.Set(x, y, BLACK)
-				}
-			}
+// Flip the data modules where the mask is true
+func applyMask(s *Symbol, mask func(int, int) bool) {
+	iterateRect(s.Width(), s.Height(), func(x, y int) {
+		if !s.isFunction(x, y) && mask(x, y) {
+			s.Modules[y][x] = !s.Modules[y][x]
 		}
-	}
+	})
 }
 
-func determinePenalty(masked *image.RGBA) int {
+func determinePenalty(masked *Symbol) int {
 	var penalty int
 
 	// Evaluation condition 1a (rows)
-	for y := 0; y < masked.Rect.Dy(); y++ {
+	for y := 0; y < masked.Height(); y++ {
 		consecutiveCount := 0
 		consecutiveBit := true
-		for x := 0; x < masked.Rect.Dx(); x++ {
-			if masked.RGBAAt(x, y) == WHITE {
+		for x := 0; x < masked.Width(); x++ {
+			if !masked.Dark(x, y) {
 				if consecutiveBit {
 					consecutiveBit = false
 					consecutiveCount = 0
@@ -113,11 +95,11 @@ func determinePenalty(masked *image.RGBA) int {
 	}
 
 	// Evaluation condition 1b (columns)
-	for x := 0; x < masked.Rect.Dx(); x++ {
+	for x := 0; x < masked.Width(); x++ {
 		consecutiveCount := 0
 		consecutiveBit := true
-		for y := 0; y < masked.Rect.Dy(); y++ {
-			if masked.RGBAAt(x, y) == WHITE {
+		for y := 0; y < masked.Height(); y++ {
+			if !masked.Dark(x, y) {
 				if consecutiveBit {
 					consecutiveBit = false
 					consecutiveCount = 0
@@ -141,20 +123,16 @@ func determinePenalty(masked *image.RGBA) int {
 	}
 
 	// Evaluation condition 2 (squares)
-	for y := 0; y < masked.Rect.Dy()-1; y++ {
-		for x := 0; x < masked.Rect.Dx()-1; x++ {
+	for y := 0; y < masked.Height()-1; y++ {
+		for x := 0; x < masked.Width()-1; x++ {
 			// Get the 2x2 area with (x,y) as the top-left module
 			modules := [][2]int{{x + 1, y}, {x, y + 1}, {x + 1, y + 1}}
 
-			bit := true
-			if masked.RGBAAt(x, y) == WHITE {
-				bit = false
-			}
+			bit := masked.Dark(x, y)
 
 			contiguous := true
 			for _, v := range modules {
-				if (masked.RGBAAt(v[0], v[1]) != BLACK && bit) ||
-					(masked.RGBAAt(v[0], v[1]) != WHITE && !bit) {
+				if masked.Dark(v[0], v[1]) != bit {
 					contiguous = false
 					break
 				}
@@ -167,16 +145,16 @@ func determinePenalty(masked *image.RGBA) int {
 	}
 
 	// Evaluation condition 3 (similar to finder pattern)
-	for y := 0; y < masked.Rect.Dy(); y++ {
-		for x := 0; x < masked.Rect.Dx()-6; x++ {
+	for y := 0; y < masked.Height(); y++ {
+		for x := 0; x < masked.Width()-6; x++ {
 			// Check in the horizontal direction
-			if masked.RGBAAt(x, y) == BLACK &&
-				masked.RGBAAt(x+1, y) == WHITE &&
-				masked.RGBAAt(x+2, y) == BLACK &&
-				masked.RGBAAt(x+3, y) == BLACK &&
-				masked.RGBAAt(x+4, y) == BLACK &&
-				masked.RGBAAt(x+5, y) == WHITE &&
-				masked.RGBAAt(x+6, y) == BLACK {
+			if masked.Dark(x, y) &&
+				!masked.Dark(x+1, y) &&
+				masked.Dark(x+2, y) &&
+				masked.Dark(x+3, y) &&
+				masked.Dark(x+4, y) &&
+				!masked.Dark(x+5, y) &&
+				masked.Dark(x+6, y) {
 
 				// Check whether there is 4 white spaces on either side
 				if checkFourPlusOneWhite(masked, x-4, y, x-1, y, x+7, y) {
@@ -189,16 +167,16 @@ func determinePenalty(masked *image.RGBA) int {
 		}
 	}
 
-	for x := 0; x < masked.Rect.Dx(); x++ {
-		for y := 0; y < masked.Rect.Dy()-6; y++ {
+	for x := 0; x < masked.Width(); x++ {
+		for y := 0; y < masked.Height()-6; y++ {
 			// Check in the vertical direction
-			if masked.RGBAAt(x, y) == BLACK &&
-				masked.RGBAAt(x, y+1) == WHITE &&
-				masked.RGBAAt(x, y+2) == BLACK &&
-				masked.RGBAAt(x, y+3) == BLACK &&
-				masked.RGBAAt(x, y+4) == BLACK &&
-				masked.RGBAAt(x, y+5) == WHITE &&
-				masked.RGBAAt(x, y+6) == BLACK {
+			if masked.Dark(x, y) &&
+				!masked.Dark(x, y+1) &&
+				masked.Dark(x, y+2) &&
+				masked.Dark(x, y+3) &&
+				masked.Dark(x, y+4) &&
+				!masked.Dark(x, y+5) &&
+				masked.Dark(x, y+6) {
 
 				if checkFourPlusOneWhite(masked, x, y-4, x, y-1, x, y+7) {
 					penalty += 40
@@ -213,9 +191,9 @@ func determinePenalty(masked *image.RGBA) int {
 	// Evaluation condition 4 (white-dark module ratio)
 	total := 0
 	dark := 0
-	for y := 0; y < masked.Rect.Dy(); y++ {
-		for x := 0; x < masked.Rect.Dx(); x++ {
-			if masked.RGBAAt(x, y) == BLACK {
+	for y := 0; y < masked.Height(); y++ {
+		for x := 0; x < masked.Width(); x++ {
+			if masked.Dark(x, y) {
 				dark++
 			}
 
@@ -235,15 +213,15 @@ func determinePenalty(masked *image.RGBA) int {
 	return penalty
 }
 
-func checkFourPlusOneWhite(img *image.RGBA, x1, y1, x2, y2, x3, y3 int) bool {
+// Returns true if the modules from (x1,y1) to (x2,y2) and the module at (x3,y3) are all light.
+// Modules outside of the symbol count as light
+func checkFourPlusOneWhite(s *Symbol, x1, y1, x2, y2, x3, y3 int) bool {
 	var foundBlack bool
-	oob := color.RGBA{}
 	iterateRect(x2-x1+1, y2-y1+1, func(x, y int) {
-		c := img.RGBAAt(x1+x, y1+y)
-		if c != WHITE && c != oob {
+		if s.Dark(x1+x, y1+y) {
 			foundBlack = true
 		}
 	})
 
-	return !foundBlack && (img.RGBAAt(x3, y3) == WHITE || img.RGBAAt(x3, y3) == oob)
+	return !foundBlack && !s.Dark(x3, y3)
 }
@@ -0,0 +1,430 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+type microBlock struct {
+	// The number of data bits. In M1 and M3, the last data codeword is only 4 bits.
+	dataBits int
+	ecWords  int
+}
+
+// Micro qr codes only have one block. M1 can only detect errors, and is used for level L.
+var microCodeWordTable = map[int]map[string]microBlock{
+	1: {
+		"L": {dataBits: 20, ecWords: 2},
+	},
+	2: {
+		"L": {dataBits: 40, ecWords: 5},
+		"M": {dataBits: 32, ecWords: 6},
+	},
+	3: {
+		"L": {dataBits: 84, ecWords: 6},
+		"M": {dataBits: 68, ecWords: 8},
+	},
+	4: {
+		"L": {dataBits: 128, ecWords: 8},
+		"M": {dataBits: 112, ecWords: 10},
+		"Q": {dataBits: 80, ecWords: 14},
+	},
+}
+
+// The symbol number stored in the format information for each version and ec level
+var microSymbolNumbers = map[int]map[string]int{
+	1: {"L": 0},
+	2: {"L": 1, "M": 2},
+	3: {"L": 3, "M": 4},
+	4: {"L": 5, "M": 6, "Q": 7},
+}
+
+// Micro qr codes can only use 4 of the masks
+var microMasks = []int{1, 4, 6, 7}
+
+func microDataFormat(version int) dataFormat {
+	// Every character set has its own mode indicator and shorter character counts,
+	// although the smaller versions can't use every character set
+	f := dataFormat{
+		modeBits:       version - 1,
+		modes:          map[CharacterSet]int{Numeric: 0},
+		countBits:      map[CharacterSet]int{Numeric: version + 2},
+		terminatorBits: version*2 + 1,
+	}
+
+	if version >= 2 {
+		f.modes[Alphanumeric] = 1
+		f.countBits[Alphanumeric] = version + 1
+	}
+
+	if version >= 3 {
+		f.modes[Bytes] = 2
+		f.countBits[Bytes] = version + 1
+		f.modes[Kanji] = 3
+		f.countBits[Kanji] = version
+	}
+
+	return f
+}
+
+// Create a micro qr code from data with options, which may be nil.
+// The version is from 1 to 4 (M1 to M4), and if unset will be the smallest that can fit the data.
+// M1 can only detect errors rather than correct them, so it is only used for level L.
+// If the level is unset, M1 is used when the data fits in it, and larger versions use level M.
+// Micro qr codes can't use ECI or GS1.
+func CreateMicro(data []byte, opts *CreateOptions) (*Symbol, error) {
+	return createMicroQRCode(data, opts)
+}
+
+// Like CreateMicro, but panics if the code can't be created
+func CreateMicroQRCode(data []byte, opts *CreateOptions) *image.RGBA {
+	s, err := CreateMicro(data, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return s.Render(1)
+}
+
+func createMicroQRCode(data []byte, opts *CreateOptions) (*Symbol, error) {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+
+	if _, ok := microCodeWordTable[4][opts.ErrorCorrectionLevel]; !ok && opts.ErrorCorrectionLevel != "" {
+		return nil, fmt.Errorf("%w %q: micro qr codes can only use L, M and Q", ErrInvalidECLevel, opts.ErrorCorrectionLevel)
+	}
+
+	if opts.Version < 0 || opts.Version > 4 {
+		return nil, fmt.Errorf("%w: micro qr codes are from M1 to M4, not %v", ErrInvalidVersion, opts.Version)
+	}
+
+	if opts.ECI != nil || opts.GS1 {
+		return nil, fmt.Errorf("%w: micro qr codes can't use eci or gs1", ErrUnsupportedMode)
+	}
+
+	var version int
+	if opts.Version == 0 {
+		// We will iteratively increase version until data fits
+		version = 1
+	} else {
+		version = opts.Version
+	}
+
+	var dataBits Bits
+	var block microBlock
+	var ecLevel string
+	for ; ; version++ {
+		// Smaller versions can be skipped if the version is unset in options
+		canGrow := version != opts.Version && version != 4
+		format := microDataFormat(version)
+
+		// M1 only has level L, which can only detect errors
+		ecLevel = opts.ErrorCorrectionLevel
+		if ecLevel == "" && version == 1 {
+			ecLevel = "L"
+		} else if ecLevel == "" {
+			ecLevel = "M"
+		}
+
+		var ok bool
+		block, ok = microCodeWordTable[version][ecLevel]
+		if !ok {
+			if canGrow {
+				continue
+			}
+			return nil, fmt.Errorf("%w %q: M%v codes can't use it", ErrInvalidECLevel, ecLevel, version)
+		}
+
+		// Encode data
+		var segments []segment
+		if opts.CharacterSet != nil {
+			segments = []segment{{mode: *opts.CharacterSet, data: data}}
+		} else if opts.DisableSegmentation {
+			segments = []segment{{mode: AutodetectCharacterSet(data), data: data}}
+		} else {
+			segments = segmentData(data, format, false)
+		}
+
+		// Check whether this version has the character sets that are needed
+		supported := segments != nil || len(data) == 0
+		for _, v := range segments {
+			if _, ok := format.modes[v.mode]; !ok {
+				supported = false
+			}
+		}
+
+		if !supported {
+			if canGrow {
+				continue
+			}
+			return nil, fmt.Errorf("%w: M%v codes can't encode the data", ErrUnsupportedMode, version)
+		}
+
+		// Check whether the data fits
+		var err error
+		dataBits, err = encodeSegments(segments, format, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(dataBits) > block.dataBits {
+			if canGrow {
+				continue
+			}
+			return nil, &DataTooLargeError{
+				Required:  len(dataBits),
+				Available: block.dataBits,
+				Symbol:    "micro qr code",
+			}
+		}
+
+		break
+	}
+
+	// Generate error correction
+	codewords := toCodewords(dataBits, block.dataBits, microDataFormat(version).terminatorBits)
+	errorWords := rsEncode(codewords, block.ecWords)
+
+	// Convert to bits, where a short last data codeword only has its upper 4 bits
+	var allBits Bits
+	for _, v := range codewords {
+		allBits = append(allBits, toBits(int(v), 8)...)
+	}
+	allBits = allBits[:block.dataBits]
+	for _, v := range errorWords {
+		allBits = append(allBits, toBits(int(v), 8)...)
+	}
+
+	s := newMicroSymbol(version)
+	s.ErrorCorrectionLevel = ecLevel
+
+	// Draw the data with a zig-zag pattern, there is no timing pattern to skip
+	writeBits(s, allBits, -1)
+
+	// Apply the best mask
+	s.Mask = applyBestMicroMask(s)
+	addMicroFormatInfo(s, ecLevel, s.Mask, version)
+
+	return s, nil
+}
+
+// Returns an empty micro qr code with its function patterns drawn
+func newMicroSymbol(version int) *Symbol {
+	s := newSymbol(9+version*2, 9+version*2)
+	s.Version = version
+	s.Micro = true
+
+	// Draw the only finder pattern
+	drawFinderPattern(s, 0, 0)
+
+	// Place temporary format bits
+	drawMicroTempFormatBits(s)
+
+	// Draw both timing patterns
+	drawMicroTimingPatterns(s)
+
+	return s
+}
+
+func drawMicroTimingPatterns(s *Symbol) {
+	// The timing patterns run along the top and left edges
+	for k := 8; k < s.Width(); k++ {
+		s.setFunction(k, 0, k%2 == 0)
+		s.setFunction(0, k, k%2 == 0)
+	}
+}
+
+func drawMicroTempFormatBits(s *Symbol) {
+	iterateRect(8, 1, func(x, y int) {
+		s.setFunction(x+1, 8, false)
+	})
+
+	iterateRect(1, 8, func(x, y int) {
+		s.setFunction(8, y+1, false)
+	})
+}
+
+// Returns the index of the best mask in microMasks
+func applyBestMicroMask(s *Symbol) int {
+	bestScore := -1
+	bestMask := 0
+	for k, v := range microMasks {
+		// Make a copy of the symbol
+		masked := s.copy()
+
+		// Apply the mask
+		applyMask(masked, Masks[v])
+
+		// Count the dark modules along the right and bottom edges
+		var sum1, sum2 int
+		for k := 1; k < masked.Width(); k++ {
+			if masked.Dark(masked.Width()-1, k) {
+				sum1++
+			}
+			if masked.Dark(k, masked.Height()-1) {
+				sum2++
+			}
+		}
+
+		// Unlike normal qr codes, the mask with the highest score is the best
+		var score int
+		if sum1 <= sum2 {
+			score = sum1*16 + sum2
+		} else {
+			score = sum2*16 + sum1
+		}
+
+		if score > bestScore {
+			bestScore = score
+			bestMask = k
+		}
+	}
+
+	applyMask(s, Masks[microMasks[bestMask]])
+
+	return bestMask
+}
+
+func addMicroFormatInfo(s *Symbol, ecLevel string, maskPattern int, version int) {
+	// Generate 15 bits of format info
+	symbolNumber, ok := microSymbolNumbers[version][ecLevel]
+	if !ok {
+		panic("invalid error correction level")
+	}
+
+	if maskPattern > 3 || maskPattern < 0 {
+		panic("invalid mask pattern")
+	}
+
+	code := symbolNumber<<2 | maskPattern
+	encodedFormat := ((code << 10) | checkFormat(code<<10))
+	maskedFormat := 0b100010001000101 ^ encodedFormat
+
+	// Convert into modules
+	modules := formatModules(maskedFormat, 15)
+
+	// Write format info, down the right of the finder pattern and then back along the bottom
+	for i := 0; i < 8; i++ {
+		s.setFunction(8, i+1, modules[i])
+	}
+	for i := 8; i < 15; i++ {
+		s.setFunction(15-i, 8, modules[i])
+	}
+}
+
+// Decode the modules of a micro qr code
+func decodeMicroQRCode(s *Symbol) (QRCodeResult, error) {
+	// Get format info
+	var formatBits int
+	for k := 0; k < 8; k++ {
+		if s.Dark(8, k+1) {
+			formatBits |= 1 << k
+		}
+	}
+	for k := 8; k < 15; k++ {
+		if s.Dark(15-k, 8) {
+			formatBits |= 1 << k
+		}
+	}
+
+	// Apply EC and convert
+	formatBits, formatErrors := decodeFormat(formatBits ^ 0b100010001000101)
+	if formatBits < 0 {
+		return QRCodeResult{}, errors.New("unable to decode format information")
+	}
+
+	symbolNumber := formatBits >> 2
+	maskPattern := formatBits & 0b11
+
+	// Find the version and ec level of the symbol number
+	var version int
+	var ecLevel string
+	for v, levels := range microSymbolNumbers {
+		for l, n := range levels {
+			if n == symbolNumber {
+				version = v
+				ecLevel = l
+			}
+		}
+	}
+
+	if version == 0 {
+		return QRCodeResult{}, errors.New("invalid symbol number")
+	}
+
+	if s.Width() != version*2+9 || s.Height() != version*2+9 {
+		return QRCodeResult{}, fmt.Errorf("format information is for M%v, but code is %v modules wide", version, s.Width())
+	}
+
+	// Mask off fixed patterns
+	s.Function = newMicroSymbol(version).Function
+
+	// Read data in zig zag path
+	block := microCodeWordTable[version][ecLevel]
+	bits := readBits(s, Masks[microMasks[maskPattern]], -1)
+	if len(bits) < block.dataBits+block.ecWords*8 {
+		return QRCodeResult{}, errors.New("code has too few modules")
+	}
+
+	// Convert into codewords, where a short last data codeword only has its upper 4 bits
+	dataBits := append(Bits{}, bits[:block.dataBits]...)
+	for len(dataBits)%8 != 0 {
+		dataBits = append(dataBits, 0)
+	}
+	dataBits = append(dataBits, bits[block.dataBits:block.dataBits+block.ecWords*8]...)
+
+	var msg []int
+	for k := 0; k < len(dataBits); k += 8 {
+		var byt int
+		for j := 0; j < 8; j++ {
+			byt |= int(dataBits[k+j]) << (7 - j)
+		}
+		msg = append(msg, byt)
+	}
+
+	result := QRCodeResult{
+		ErrorCorrectionLevel: ecLevel,
+		Version:              version,
+		Micro:                true,
+		Mask:                 maskPattern,
+		Quality: DecodeQuality{
+			CorrectedCodewords: []int{0},
+			FormatErrors:       formatErrors,
+			VersionErrors:      -1,
+		},
+	}
+
+	// Error correct
+	var corrected []int
+	if version == 1 {
+		// M1 codes can only detect errors
+		if !checkMessage(msg, block.ecWords) {
+			return QRCodeResult{}, errors.New("errors detected in M1 code, which can't be corrected")
+		}
+		corrected = msg[:len(msg)-block.ecWords]
+	} else {
+		var correctedPos []int
+		var err error
+		corrected, correctedPos, err = correctMessage(msg, block.ecWords, nil)
+		if err != nil {
+			return QRCodeResult{}, err
+		}
+
+		result.Quality.CorrectedCodewords[0] = len(correctedPos)
+		result.Quality.ECCapacityUsed = float64(ecCapacityUsed(correctedPos, nil)) / float64(block.ecWords)
+	}
+
+	datawords := make([]uint8, len(corrected))
+	for k, v := range corrected {
+		datawords[k] = uint8(v)
+	}
+
+	// Decode every segment
+	err := decodeData(datawords, block.dataBits, microDataFormat(version), &result)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package polishedqr
+
+import "testing"
+
+// Micro qr codes use M1 when no level is given, as long as the data fits
+func TestMicroDefaultLevel(t *testing.T) {
+	for _, v := range []struct {
+		data    string
+		version int
+		ecLevel string
+	}{
+		{"12345", 1, "L"},
+		{"12345678", 2, "M"},
+		{"HELLO", 2, "M"},
+	} {
+		s, err := CreateMicro([]byte(v.data), nil)
+		if err != nil {
+			t.Fatalf("error creating micro qr code for %q: %v", v.data, err)
+		}
+		if s.Version != v.version || s.ErrorCorrectionLevel != v.ecLevel {
+			t.Errorf("created M%v-%v for %q, expected M%v-%v", s.Version, s.ErrorCorrectionLevel, v.data, v.version, v.ecLevel)
+		}
+	}
+
+	// The options aren't changed
+	opts := &CreateOptions{}
+	if _, err := CreateMicro([]byte("1"), opts); err != nil || opts.ErrorCorrectionLevel != "" {
+		t.Errorf("creating micro qr code returned %v and set level %q", err, opts.ErrorCorrectionLevel)
+	}
+}
+
+// Create a micro qr code of every version and level and read it back
+func TestMicroRoundTrip(t *testing.T) {
+	for version := 1; version <= 4; version++ {
+		for _, ecLevel := range []string{"L", "M", "Q"} {
+			if _, ok := microCodeWordTable[version][ecLevel]; !ok {
+				continue
+			}
+
+			// M1 only has numeric mode
+			data := "123"
+			if version > 1 {
+				data = "AB12"
+			}
+
+			s, err := CreateMicro([]byte(data), &CreateOptions{Version: version, ErrorCorrectionLevel: ecLevel})
+			if err != nil {
+				t.Fatalf("error creating M%v-%v: %v", version, ecLevel, err)
+			}
+
+			result := readSymbol(t, s, nil)
+			if !result.Micro || result.Version != version || result.ErrorCorrectionLevel != ecLevel {
+				t.Errorf("read M%v-%v (micro %v), expected M%v-%v", result.Version, result.ErrorCorrectionLevel, result.Micro, version, ecLevel)
+			}
+			if string(result.Data) != data {
+				t.Errorf("read %q from M%v-%v, expected %q", result.Data, version, ecLevel, data)
+			}
+		}
+	}
+}
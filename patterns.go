@@ -1,105 +1,90 @@
 package polishedqr
 
-import (
-	"image"
-	"image/color"
-	"image/draw"
-)
-
-func drawFinderPattern(i *image.RGBA, x0, y0 int) {
+func drawFinderPattern(s *Symbol, x0, y0 int) {
 	iterateRect(9, 9, func(x, y int) {
-		i.SetRGBA(x0+x-1, y0+y-1, WHITE)
+		s.setFunction(x0+x-1, y0+y-1, false)
 	})
 
 	iterateRect(7, 7, func(x, y int) {
-		i.SetRGBA(x0+x, y0+y, BLACK)
+		s.setFunction(x0+x, y0+y, true)
 	})
 
 	iterateRect(5, 5, func(x, y int) {
-		i.SetRGBA(x0+x+1, y0+y+1, WHITE)
+		s.setFunction(x0+x+1, y0+y+1, false)
 	})
 
 	iterateRect(3, 3, func(x, y int) {
-		i.SetRGBA(x0+x+2, y0+y+2, BLACK)
+		s.setFunction(x0+x+2, y0+y+2, true)
 	})
 }
 
-func drawTimingPatterns(i *image.RGBA) {
-	black := true
-	iterateRect(1, i.Rect.Dx()-16, func(x, y int) {
-		if black {
-			i.SetRGBA(x+6, y+8, BLACK)
-		} else {
-			i.SetRGBA(x+6, y+8, WHITE)
-		}
-		black = !black
+func drawTimingPatterns(s *Symbol) {
+	dark := true
+	iterateRect(1, s.Width()-16, func(x, y int) {
+		s.setFunction(x+6, y+8, dark)
+		dark = !dark
 	})
 
-	black = true
-	iterateRect(i.Rect.Dy()-16, 1, func(x, y int) {
-		if black {
-			i.SetRGBA(x+8, y+6, BLACK)
-		} else {
-			i.SetRGBA(x+8, y+6, WHITE)
-		}
-		black = !black
+	dark = true
+	iterateRect(s.Height()-16, 1, func(x, y int) {
+		s.setFunction(x+8, y+6, dark)
+		dark = !dark
 	})
 }
 
-func drawAlignmentPattern(i *image.RGBA, x0, y0 int) {
+func drawAlignmentPattern(s *Symbol, x0, y0 int) {
 	iterateRect(5, 5, func(x, y int) {
-		i.SetRGBA(x0+x, y0+y, BLACK)
+		s.setFunction(x0+x, y0+y, true)
 	})
 
 	iterateRect(3, 3, func(x, y int) {
-		i.SetRGBA(x0+x+1, y0+y+1, WHITE)
+		s.setFunction(x0+x+1, y0+y+1, false)
 	})
 
-	i.SetRGBA(x0+2, y0+2, BLACK)
+	s.setFunction(x0+2, y0+2, true)
 }
 
-func drawTempFormatBits(i *image.RGBA) {
+func drawTempFormatBits(s *Symbol) {
 	iterateRect(9, 1, func(x, y int) {
-		i.SetRGBA(x, 8, WHITE)
+		s.setFunction(x, 8, false)
 	})
 
 	iterateRect(1, 8, func(x, y int) {
-		i.SetRGBA(8, y, WHITE)
+		s.setFunction(8, y, false)
 	})
 
 	iterateRect(9, 1, func(x, y int) {
-		i.SetRGBA(i.Rect.Dx()-x, 8, WHITE)
+		s.setFunction(s.Width()-x, 8, false)
 	})
 
 	iterateRect(1, 8, func(x, y int) {
-		i.SetRGBA(8, i.Rect.Dy()-y, WHITE)
+		s.setFunction(8, s.Height()-y, false)
 	})
 
-	i.SetRGBA(8, i.Rect.Dy()-8, BLACK)
+	s.setFunction(8, s.Height()-8, true)
 }
 
-func drawTempVersionBits(i *image.RGBA) {
+func drawTempVersionBits(s *Symbol) {
 	iterateRect(3, 6, func(x, y int) {
-		i.SetRGBA(i.Rect.Dx()-9-x, y, WHITE)
+		s.setFunction(s.Width()-9-x, y, false)
 	})
 
 	iterateRect(6, 3, func(x, y int) {
-		i.SetRGBA(x, i.Rect.Dy()-9-y, WHITE)
+		s.setFunction(x, s.Height()-9-y, false)
 	})
 }
 
-func quietZone(i *image.RGBA) *image.RGBA {
-	n := image.NewRGBA(image.Rect(0, 0, i.Rect.Dx()+8, i.Rect.Dy()+8))
-	iterateRect(n.Rect.Dx(), n.Rect.Dy(), func(x, y int) {
-		n.SetRGBA(x, y, WHITE)
-	})
-
-	draw.Draw(n, image.Rect(4, 4, i.Rect.Dx()+4, i.Rect.Dy()+4), i, image.Pt(0, 0), draw.Over)
+// Convert the lowest n bits of format information into modules, least significant first
+func formatModules(format int, n int) []bool {
+	var modules []bool
+	for i := 0; i < n; i++ {
+		modules = append(modules, format&(1<<i) > 0)
+	}
 
-	return n
+	return modules
 }
 
-func addFormatAndVersionInfo(img *image.RGBA, ecLevel string, maskPattern int, version int) {
+func addFormatAndVersionInfo(s *Symbol, ecLevel string, maskPattern int, version int) {
 	// Generate 15 bits of format info
 	var ecNum int
 	switch ecLevel {
@@ -123,71 +108,57 @@ func addFormatAndVersionInfo(img *image.RGBA, ecLevel string, maskPattern int, v
 	encodedFormat := ((code << 10) | checkFormat(code<<10))
 	maskedFormat := 0b101010000010010 ^ encodedFormat
 
-	// Convert into colors
-	var colors []color.RGBA
-	for i := 0; i < 15; i++ {
-		if maskedFormat&(1<<i) > 0 {
-			colors = append(colors, BLACK)
-		} else {
-			colors = append(colors, WHITE)
-		}
-	}
+	// Convert into modules
+	modules := formatModules(maskedFormat, 15)
 
 	// Write format info (top left)
-	img.SetRGBA(8, 0, colors[0])
-	img.SetRGBA(8, 1, colors[1])
-	img.SetRGBA(8, 2, colors[2])
-	img.SetRGBA(8, 3, colors[3])
-	img.SetRGBA(8, 4, colors[4])
-	img.SetRGBA(8, 5, colors[5])
-	img.SetRGBA(8, 7, colors[6])
-	img.SetRGBA(8, 8, colors[7])
-	img.SetRGBA(7, 8, colors[8])
-	img.SetRGBA(5, 8, colors[9])
-	img.SetRGBA(4, 8, colors[10])
-	img.SetRGBA(3, 8, colors[11])
-	img.SetRGBA(2, 8, colors[12])
-	img.SetRGBA(1, 8, colors[13])
-	img.SetRGBA(0, 8, colors[14])
+	s.setFunction(8, 0, modules[0])
+	s.setFunction(8, 1, modules[1])
+	s.setFunction(8, 2, modules[2])
+	s.setFunction(8, 3, modules[3])
+	s.setFunction(8, 4, modules[4])
+	s.setFunction(8, 5, modules[5])
+	s.setFunction(8, 7, modules[6])
+	s.setFunction(8, 8, modules[7])
+	s.setFunction(7, 8, modules[8])
+	s.setFunction(5, 8, modules[9])
+	s.setFunction(4, 8, modules[10])
+	s.setFunction(3, 8, modules[11])
+	s.setFunction(2, 8, modules[12])
+	s.setFunction(1, 8, modules[13])
+	s.setFunction(0, 8, modules[14])
 
 	// Write format info (top right)
-	img.SetRGBA(img.Rect.Dx()-1, 8, colors[0])
-	img.SetRGBA(img.Rect.Dx()-2, 8, colors[1])
-	img.SetRGBA(img.Rect.Dx()-3, 8, colors[2])
-	img.SetRGBA(img.Rect.Dx()-4, 8, colors[3])
-	img.SetRGBA(img.Rect.Dx()-5, 8, colors[4])
-	img.SetRGBA(img.Rect.Dx()-6, 8, colors[5])
-	img.SetRGBA(img.Rect.Dx()-7, 8, colors[6])
-	img.SetRGBA(img.Rect.Dx()-8, 8, colors[7])
+	s.setFunction(s.Width()-1, 8, modules[0])
+	s.setFunction(s.Width()-2, 8, modules[1])
+	s.setFunction(s.Width()-3, 8, modules[2])
+	s.setFunction(s.Width()-4, 8, modules[3])
+	s.setFunction(s.Width()-5, 8, modules[4])
+	s.setFunction(s.Width()-6, 8, modules[5])
+	s.setFunction(s.Width()-7, 8, modules[6])
+	s.setFunction(s.Width()-8, 8, modules[7])
 
 	// Write format info (bottom left)
-	img.SetRGBA(8, img.Rect.Dy()-7, colors[8])
-	img.SetRGBA(8, img.Rect.Dy()-6, colors[9])
-	img.SetRGBA(8, img.Rect.Dy()-5, colors[10])
-	img.SetRGBA(8, img.Rect.Dy()-4, colors[11])
-	img.SetRGBA(8, img.Rect.Dy()-3, colors[12])
-	img.SetRGBA(8, img.Rect.Dy()-2, colors[13])
-	img.SetRGBA(8, img.Rect.Dy()-1, colors[14])
+	s.setFunction(8, s.Height()-7, modules[8])
+	s.setFunction(8, s.Height()-6, modules[9])
+	s.setFunction(8, s.Height()-5, modules[10])
+	s.setFunction(8, s.Height()-4, modules[11])
+	s.setFunction(8, s.Height()-3, modules[12])
+	s.setFunction(8, s.Height()-2, modules[13])
+	s.setFunction(8, s.Height()-1, modules[14])
 
 	// Add version info
 	if version >= 7 {
 		encodedVersion := ((version << 12) | checkVersion(version<<12))
 
-		// Convert to colors
-		var colors []color.RGBA
-		for i := 0; i < 18; i++ {
-			if encodedVersion&(1<<i) > 0 {
-				colors = append(colors, BLACK)
-			} else {
-				colors = append(colors, WHITE)
-			}
-		}
+		// Convert to modules
+		modules := formatModules(encodedVersion, 18)
 
 		// Write version info (top right)
 		var i int
 		for y := 0; y < 6; y++ {
-			for x := img.Rect.Dx() - 11; x < img.Rect.Dx()-8; x++ {
-				img.SetRGBA(x, y, colors[i])
+			for x := s.Width() - 11; x < s.Width()-8; x++ {
+				s.setFunction(x, y, modules[i])
 				i++
 			}
 		}
@@ -195,82 +166,79 @@ func addFormatAndVersionInfo(img *image.RGBA, ecLevel string, maskPattern int, v
 		// Write version info (bottom left)
 		i = 0
 		for x := 0; x < 6; x++ {
-			for y := img.Rect.Dy() - 11; y < img.Rect.Dy()-8; y++ {
-				img.SetRGBA(x, y, colors[i])
+			for y := s.Height() - 11; y < s.Height()-8; y++ {
+				s.setFunction(x, y, modules[i])
 				i++
 			}
 		}
 	}
 }
 
-func writeData(img *image.RGBA, data []uint8) {
-	// Convert data into a series of colors
-	var colors []color.RGBA
+func writeData(s *Symbol, data []uint8) {
+	var bits Bits
 	for _, v := range data {
-		for i := 7; i >= 0; i-- {
-			if v&(1<<i) > 0 {
-				colors = append(colors, GREEN)
-			} else {
-				colors = append(colors, RED)
-			}
+		bits = append(bits, toBits(int(v), 8)...)
+	}
+
+	writeBits(s, bits, 6)
+}
+
+// Visit the data modules (those that aren't function patterns) in a zig zag pattern,
+// skipping over the vertical timing pattern in timingColumn
+func zigZag(s *Symbol, timingColumn int, callback func(x, y int)) {
+	visit := func(x, y int) {
+		if !s.isFunction(x, y) {
+			callback(x, y)
 		}
 	}
 
-	// Draw in a zig zag pat
 	direction := 1
-	currentBit := 0
-	for x := img.Rect.Dx() - 1; x >= 0; x -= 2 {
-		if x == 6 {
+	for x := s.Width() - 1; x >= 0; x -= 2 {
+		if x == timingColumn {
 			// Skip the vertical timing pattern
 			x--
 		}
 
 		if direction == 1 {
 			// Upwards
-			for y := img.Rect.Dy() - 1; y >= 0; y-- {
-				// Right module
-				if img.RGBAAt(x, y) == BLUE {
-					img.SetRGBA(x, y, colors[currentBit])
-					currentBit++
-				}
-				if currentBit >= len(colors) {
-					colors = append(colors, RED)
-				}
-
-				// Left module
-				if img.RGBAAt(x-1, y) == BLUE {
-					img.SetRGBA(x-1, y, colors[currentBit])
-					currentBit++
-				}
-				if currentBit >= len(colors) {
-					colors = append(colors, RED)
-				}
+			for y := s.Height() - 1; y >= 0; y-- {
+				visit(x, y)
+				visit(x-1, y)
 			}
 
 			direction = 0
 		} else {
 			// Downwards
-			for y := 0; y < img.Rect.Dy(); y++ {
-				// Right module
-				if img.RGBAAt(x, y) == BLUE {
-					img.SetRGBA(x, y, colors[currentBit])
-					currentBit++
-				}
-				if currentBit >= len(colors) {
-					colors = append(colors, RED)
-				}
-
-				// Left module
-				if img.RGBAAt(x-1, y) == BLUE {
-					img.SetRGBA(x-1, y, colors[currentBit])
-					currentBit++
-				}
-				if currentBit >= len(colors) {
-					colors = append(colors, RED)
-				}
+			for y := 0; y < s.Height(); y++ {
+				visit(x, y)
+				visit(x-1, y)
 			}
 
 			direction = 1
 		}
 	}
 }
+
+// Draw bits onto the data modules in a zig zag pattern, before they are masked.
+// Modules after the end of the bits are left light
+func writeBits(s *Symbol, bits Bits, timingColumn int) {
+	var currentBit int
+	zigZag(s, timingColumn, func(x, y int) {
+		s.Modules[y][x] = currentBit < len(bits) && bits[currentBit] > 0
+		currentBit++
+	})
+}
+
+// Read bits from the data modules in a zig zag pattern, removing the data mask
+func readBits(s *Symbol, mask func(int, int) bool, timingColumn int) Bits {
+	var bits Bits
+	zigZag(s, timingColumn, func(x, y int) {
+		if s.Modules[y][x] != mask(x, y) {
+			bits = append(bits, 1)
+		} else {
+			bits = append(bits, 0)
+		}
+	})
+
+	return bits
+}
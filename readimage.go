@@ -0,0 +1,699 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"time"
+)
+
+// Options for reading codes from images
+type ReadOptions struct {
+	// The ways of splitting the image into dark and light pixels, which are tried in order
+	// until one of them finds a code. Defaults to global, hybrid, mean and then Sauvola
+	Binarizers []Binarizer
+
+	// Don't retry with dark and light swapped, for light codes on dark backgrounds
+	DisableInverted bool
+
+	// Don't retry reading codes as a mirror image, such as when they are seen through glass
+	DisableMirrored bool
+
+	// Spend longer looking for codes that can't be found at first,
+	// by also reading the image at half and double its size
+	TryHarder bool
+
+	// The image is just a single code and its quiet zone, such as one made by Create,
+	// so read it directly instead of searching for finder patterns.
+	// The code can only be rotated by multiples of 90 degrees
+	Pure bool
+
+	// The ECI assignment to assume for byte segments that don't have one, such as ECIShiftJIS.
+	// Those segments are converted into utf-8, like the ones with an ECI.
+	// If unset, they are left as they are
+	ECI *int
+
+	// The camera to read from, when reading from a webcam
+	Device int
+
+	// The frame rate to ask the camera for, when reading from a webcam. Defaults to 30
+	FrameRate float64
+
+	// How long a code has to be out of sight before a Scanner sends it again. Defaults to 2 seconds
+	Cooldown time.Duration
+
+	// If set, it is filled in with images of how the last attempt at reading the image went,
+	// even if no code was found. Don't share it between reads that run at the same time
+	Debug *DebugInfo
+}
+
+func (opts *ReadOptions) binarizers() []Binarizer {
+	if opts == nil || len(opts.Binarizers) == 0 {
+		return defaultBinarizers
+	}
+
+	return opts.Binarizers
+}
+
+func (opts *ReadOptions) inverted() bool {
+	return opts == nil || !opts.DisableInverted
+}
+
+func (opts *ReadOptions) mirrored() bool {
+	return opts == nil || !opts.DisableMirrored
+}
+
+func (opts *ReadOptions) debug() *DebugInfo {
+	if opts == nil {
+		return nil
+	}
+
+	return opts.Debug
+}
+
+func (opts *ReadOptions) frameRate() float64 {
+	if opts == nil || opts.FrameRate == 0 {
+		return 30
+	}
+
+	return opts.FrameRate
+}
+
+// The sizes to read the image at when trying harder, relative to the original
+var tryHarderScales = []float64{0.5, 2}
+
+// Images aren't scaled up beyond this many pixels on a side
+const maxScaledSize = 4096
+
+// The number of triples of finder patterns in a row that can fail to decode before the rest are skipped.
+// The best triples are tried first, so the rest are mostly patterns in the data or the background
+const maxFailedTriples = 32
+
+// Read a qr code or micro qr code from an image, without needing OpenCV.
+// opts may be nil to use the defaults. It is safe to read several images at the same time,
+// as long as they don't share a DebugInfo
+func ReadFromImage(img image.Image, opts *ReadOptions) (QRCodeResult, error) {
+	results, _, err := readImage(img, opts, 1)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	return results[0], nil
+}
+
+// Read every qr code and micro qr code in an image, such as a sheet of labels.
+// Each result has the location of its code in the image.
+func ReadAllFromImage(img image.Image, opts *ReadOptions) ([]QRCodeResult, error) {
+	results, _, err := readImage(img, opts, 0)
+	return results, err
+}
+
+// Read up to limit codes from an image, or every code if limit is 0, trying each binarizer in turn,
+// and then with dark and light swapped. Also returns the bitmap that the codes were found in,
+// which is scaled if they were only found by trying harder
+func readImage(img image.Image, opts *ReadOptions, limit int) ([]QRCodeResult, *bitmap, error) {
+	gray := toGray(img)
+
+	results, b, err := readGray(gray, opts, limit)
+	if err != nil && opts != nil && opts.TryHarder {
+		for _, f := range tryHarderScales {
+			width, height := int(float64(gray.width)*f), int(float64(gray.height)*f)
+			if width < 11 || height < 11 || width > maxScaledSize || height > maxScaledSize {
+				// Too small to hold the smallest micro qr code, or too big to be worth it
+				continue
+			}
+
+			var scaledErr error
+			results, b, scaledErr = readGray(gray.scaled(width, height), opts, limit)
+			if scaledErr == nil {
+				// Move the codes back to where they are in the original image
+				for i := range results {
+					results[i].Location = results[i].Location.scaled(float64(gray.width) / float64(width))
+				}
+				err = nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts != nil && opts.ECI != nil {
+		for i := range results {
+			assumeECI(&results[i], *opts.ECI)
+		}
+	}
+
+	return results, b, nil
+}
+
+// Read up to limit codes from a grayscale image, trying each binarizer in turn,
+// and then with dark and light swapped
+func readGray(gray *grayImage, opts *ReadOptions, limit int) ([]QRCodeResult, *bitmap, error) {
+	var firstErr error
+	for _, v := range opts.binarizers() {
+		bitmaps := []*bitmap{gray.binarize(v)}
+		if opts.inverted() {
+			bitmaps = append(bitmaps, bitmaps[0].inverted())
+		}
+
+		for k, b := range bitmaps {
+			debug := opts.debug()
+			debug.reset(b)
+
+			var results []QRCodeResult
+			var err error
+			if opts != nil && opts.Pure {
+				var result QRCodeResult
+				result, err = readPureImage(b, opts.mirrored(), debug)
+				results = []QRCodeResult{result}
+			} else {
+				results, err = readSymbols(b, limit, opts.mirrored(), debug)
+			}
+			debug.drawCandidates(b)
+
+			if err == nil {
+				for i := range results {
+					results[i].Inverted = k == 1
+				}
+				return results, b, nil
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return nil, nil, firstErr
+}
+
+// Read up to limit codes from an image, or every code if limit is 0.
+// If mirrored is set, codes that can't be read are tried again as a mirror image.
+// debug may be nil
+func readSymbols(b *bitmap, limit int, mirrored bool, debug *DebugInfo) ([]QRCodeResult, error) {
+	candidates := findFinderPatterns(b)
+	debug.addFinderPatterns(candidates)
+
+	// Each finder pattern can only belong to one code
+	used := make(map[point]bool)
+	var results []QRCodeResult
+	var firstErr error
+	var failed int
+
+	// Try the triples that look most like a qr code first, giving up once many in a row have failed
+	for _, v := range finderTriples(candidates) {
+		if used[v[0].center] || used[v[1].center] || used[v[2].center] {
+			continue
+		}
+		if failed == maxFailedTriples {
+			break
+		}
+
+		result, err := readQRCodeImage(b, v, debug)
+		if err != nil && mirrored {
+			// The top right and bottom left finder patterns swap places in a mirror image
+			result, err = readQRCodeImage(b, [3]patternCandidate{v[0], v[2], v[1]}, debug)
+			result.Mirrored = true
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+
+		results = append(results, result)
+		if len(results) == limit {
+			return results, nil
+		}
+
+		for _, f := range v {
+			used[f.center] = true
+		}
+		failed = 0
+	}
+
+	// Micro qr codes only have a single finder pattern
+	for _, v := range candidates {
+		if used[v.center] {
+			continue
+		}
+
+		result, err := readMicroQRCodeImage(b, v, false, debug)
+		if err != nil && mirrored {
+			result, err = readMicroQRCodeImage(b, v, true, debug)
+			result.Mirrored = true
+		}
+		if err != nil {
+			continue
+		}
+
+		results = append(results, result)
+		if len(results) == limit {
+			return results, nil
+		}
+	}
+
+	if len(results) > 0 {
+		return results, nil
+	} else if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return nil, fmt.Errorf("could not find qr code (only %v finder patterns)", len(candidates))
+}
+
+// Read a qr code from the finder patterns in its top left, top right and bottom left corners
+func readQRCodeImage(b *bitmap, finders [3]patternCandidate, debug *DebugInfo) (QRCodeResult, error) {
+	topLeft, topRight, bottomLeft := finders[0].center, finders[1].center, finders[2].center
+
+	// Modules look wider along the rows of the image when the code is rotated,
+	// so measure the finder patterns along the sides of the code instead
+	moduleX := (finderModuleSize(b, finders[0], topRight.sub(topLeft)) + finderModuleSize(b, finders[1], topLeft.sub(topRight))) / 2
+	moduleY := (finderModuleSize(b, finders[0], bottomLeft.sub(topLeft)) + finderModuleSize(b, finders[2], topLeft.sub(bottomLeft))) / 2
+
+	// Find the provisional version from the distance between the finder patterns
+	modules := (topLeft.dist(topRight)/moduleX + topLeft.dist(bottomLeft)/moduleY) / 2
+	version := int(math.Round((modules - 10) / 4))
+	if version < 1 {
+		return QRCodeResult{}, errors.New("unable to determine provisional version")
+	}
+
+	estimate := version
+	if version > 6 {
+		// Check the version information itself, only trusting the estimate if neither copy can be read
+		transform := qrHomography(version, finders, parallelogramCorner(finders), float64(version*4+17)-3.5)
+		if v := readVersionInfo(sampleSymbol(b, transform, version*4+17, version*4+17)); v >= 7 && v <= 40 {
+			version = v
+		}
+	}
+	if version > 40 {
+		return QRCodeResult{}, fmt.Errorf("estimated version %v is too large", version)
+	}
+
+	result, err := readQRCodeVersion(b, finders, version, debug)
+	if err != nil && version != estimate && estimate <= 40 {
+		// The version information may have been corrected to the wrong version, so try the estimate too
+		if retried, retryErr := readQRCodeVersion(b, finders, estimate, debug); retryErr == nil {
+			return retried, nil
+		}
+	}
+
+	return result, err
+}
+
+// Assume the code is a parallelogram until the alignment pattern has been found
+func parallelogramCorner(finders [3]patternCandidate) point {
+	return finders[1].center.add(finders[2].center).sub(finders[0].center)
+}
+
+// Sample and decode a qr code of the given version from its finder patterns
+func readQRCodeVersion(b *bitmap, finders [3]patternCandidate, version int, debug *DebugInfo) (QRCodeResult, error) {
+	transform := qrHomography(version, finders, parallelogramCorner(finders), float64(version*4+17)-3.5)
+
+	if version > 1 {
+		// Find the bottom-rightmost alignment pattern, and use it to correct for perspective
+		aligns := getAlignmentPositions(version)
+		bottomAlign := float64(aligns[len(aligns)-1][0]) + 0.5
+
+		expected := transform.transform(point{bottomAlign, bottomAlign})
+		xAxis := transform.transform(point{bottomAlign + 1, bottomAlign}).sub(expected)
+		yAxis := transform.transform(point{bottomAlign, bottomAlign + 1}).sub(expected)
+		if align, ok := findAlignmentPattern(b, expected, xAxis, yAxis); ok {
+			transform = qrHomography(version, finders, align, bottomAlign)
+			debug.addAlignmentPattern(align)
+		}
+	}
+
+	dim := version*4 + 17
+	s := sampleSymbol(b, transform, dim, dim)
+	result, err := decodeQRCode(s, sampleConfidence(b, transform, dim, dim))
+	debug.addSymbol(b, transform, s, err)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	result.Location = newLocation(transform, dim, dim)
+
+	return result, nil
+}
+
+// Work out where a symbol is from its transform from modules to pixels
+func newLocation(transform Homography, width, height int) *Location {
+	w, h := float64(width), float64(height)
+	corners := [4]point{
+		transform.transform(point{0, 0}),
+		transform.transform(point{w, 0}),
+		transform.transform(point{w, h}),
+		transform.transform(point{0, h}),
+	}
+
+	l := &Location{Homography: transform}
+	for k, v := range corners {
+		l.Corners[k] = image.Pt(int(math.Round(v.x)), int(math.Round(v.y)))
+	}
+
+	centre := transform.transform(point{w / 2, h / 2})
+	l.Center = image.Pt(int(centre.x), int(centre.y))
+
+	// Average the opposite sides, which differ under perspective
+	l.ModuleSize = (corners[0].dist(corners[1])/w + corners[3].dist(corners[2])/w +
+		corners[0].dist(corners[3])/h + corners[1].dist(corners[2])/h) / 4
+
+	// Image y points down, so the angle of the top edge is clockwise
+	top := corners[1].sub(corners[0])
+	l.Rotation = math.Mod(math.Atan2(top.y, top.x)*180/math.Pi+360, 360)
+
+	return l
+}
+
+// Returns the location in an image that is f times the size of the one it was found in
+func (l *Location) scaled(f float64) *Location {
+	// Find the size of the symbol in modules from its bottom right corner
+	size := l.Homography.Inverse().transform(point{float64(l.Corners[2].X), float64(l.Corners[2].Y)})
+
+	scale := Homography{f, 0, 0, 0, f, 0, 0, 0, 1}
+	return newLocation(scale.mul(l.Homography), int(math.Round(size.x)), int(math.Round(size.y)))
+}
+
+// Returns the size of the modules of a finder pattern, measured along dir
+func finderModuleSize(b *bitmap, finder patternCandidate, dir point) float64 {
+	runs, _ := runsThrough(b, finder.center, dir.scale(1/math.Hypot(dir.x, dir.y)), 3, int(finder.moduleSize*10))
+	if moduleSize := matchRatio(runs, finderRatio); moduleSize != 0 {
+		return moduleSize
+	}
+
+	return finder.moduleSize
+}
+
+// Returns the transform from modules to pixels, from the centres of the finder patterns
+// and a fourth point, which is at (corner, corner) in modules
+func qrHomography(version int, finders [3]patternCandidate, fourth point, corner float64) Homography {
+	far := float64(version*4+17) - 3.5
+	return newHomography(
+		[4]point{{3.5, 3.5}, {far, 3.5}, {3.5, far}, {corner, corner}},
+		[4]point{finders[0].center, finders[1].center, finders[2].center, fourth},
+	)
+}
+
+// Sample the centre of every module of a symbol, using a transform from modules to pixels
+func sampleSymbol(b *bitmap, transform Homography, width, height int) *Symbol {
+	s := newSymbol(width, height)
+	iterateRect(width, height, func(x, y int) {
+		s.Modules[y][x] = b.atPoint(transform.transform(point{float64(x) + 0.5, float64(y) + 0.5}))
+	})
+
+	return s
+}
+
+// Returns how sure we are of each module of a symbol sampled with the transform, from 0 to 1.
+// Modules are less certain when the centre is close to the threshold,
+// or when the pixels around the centre don't agree with it
+func sampleConfidence(b *bitmap, transform Homography, width, height int) [][]float64 {
+	confidence := make([][]float64, height)
+	for y := range confidence {
+		confidence[y] = make([]float64, width)
+	}
+
+	iterateRect(width, height, func(x, y int) {
+		mx, my := float64(x)+0.5, float64(y)+0.5
+		centre := transform.transform(point{mx, my})
+		dark := b.atPoint(centre)
+
+		// Check a few points around the centre, staying well inside the module
+		agree := 1
+		for _, d := range []point{{-0.3, 0}, {0.3, 0}, {0, -0.3}, {0, 0.3}} {
+			if b.atPoint(transform.transform(point{mx + d.x, my + d.y})) == dark {
+				agree++
+			}
+		}
+
+		confidence[y][x] = b.marginAt(centre) * float64(agree) / 5
+	})
+
+	return confidence
+}
+
+// Returns the corners of the outer ring of a finder pattern, going around it
+func finderCorners(b *bitmap, finder patternCandidate) ([4]point, bool) {
+	// Find the left side of the outer ring
+	runs, c := runsThrough(b, finder.center, point{1, 0}, 3, int(finder.moduleSize*7)+2)
+	start := c.sub(point{float64(runs[2])/2 + float64(runs[1]) + float64(runs[0])/2, 0})
+	if !b.atPoint(start) {
+		return [4]point{}, false
+	}
+
+	// Flood fill the outer ring, staying close to the pattern
+	limit := finder.moduleSize * 6
+	var ring []point
+	seen := make(map[[2]int]bool)
+	stack := [][2]int{{int(start.x), int(start.y)}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if seen[p] || !b.at(p[0], p[1]) {
+			continue
+		}
+		seen[p] = true
+
+		centre := point{float64(p[0]) + 0.5, float64(p[1]) + 0.5}
+		if math.Abs(centre.x-c.x) > limit || math.Abs(centre.y-c.y) > limit {
+			// The ring shouldn't touch anything this far out
+			return [4]point{}, false
+		}
+		ring = append(ring, centre)
+
+		stack = append(stack, [2]int{p[0] + 1, p[1]}, [2]int{p[0] - 1, p[1]}, [2]int{p[0], p[1] + 1}, [2]int{p[0], p[1] - 1})
+	}
+
+	farthest := func(from point) point {
+		var best point
+		var bestDist float64
+		for _, v := range ring {
+			if d := v.dist(from); d > bestDist {
+				best = v
+				bestDist = d
+			}
+		}
+		return best
+	}
+
+	// The corners are the farthest pixels from the centre, from each other,
+	// and on either side of the diagonal between them
+	p1 := farthest(c)
+	p3 := farthest(p1)
+	var p2, p4 point
+	var min, max float64
+	diagonal := p3.sub(p1)
+	for _, v := range ring {
+		d := v.sub(p1)
+		cross := diagonal.x*d.y - diagonal.y*d.x
+		if cross > max {
+			max = cross
+			p2 = v
+		} else if cross < min {
+			min = cross
+			p4 = v
+		}
+	}
+
+	// Move each corner from the centre of its pixel out to the edge
+	corners := [4]point{p1, p2, p3, p4}
+	for k, v := range corners {
+		d := v.sub(c)
+		corners[k] = v.add(d.scale(math.Sqrt2 / 2 / math.Hypot(d.x, d.y)))
+	}
+
+	return corners, true
+}
+
+// Read a micro qr code from around its finder pattern, as a mirror image if mirrored is set
+func readMicroQRCodeImage(b *bitmap, finder patternCandidate, mirrored bool, debug *DebugInfo) (QRCodeResult, error) {
+	corners, ok := finderCorners(b, finder)
+	if !ok {
+		return QRCodeResult{}, errors.New("invalid finder pattern")
+	}
+
+	// Find the module vectors along each side of the finder pattern, going around it
+	side1 := corners[1].sub(corners[0]).scale(1.0 / 7)
+	side2 := corners[2].sub(corners[1]).scale(1.0 / 7)
+	axes := []point{side1, side2, side1.scale(-1), side2.scale(-1)}
+
+	// Try each side as the top of the code
+	for k := range axes {
+		xAxis := axes[k]
+		yAxis := axes[(k+1)%4]
+		if (xAxis.x*yAxis.y-xAxis.y*yAxis.x < 0) != mirrored {
+			// The y axis has to be clockwise from the x axis, otherwise the code is mirrored
+			yAxis = axes[(k+3)%4]
+		}
+
+		// Map modules onto pixels, from the finder pattern in the top left
+		transform := affineHomography(finder.center.sub(xAxis.scale(3.5)).sub(yAxis.scale(3.5)), xAxis, yAxis)
+		module := func(x, y float64) point {
+			return transform.transform(point{x + 0.5, y + 0.5})
+		}
+
+		// Follow a timing pattern until it stops alternating, which happens
+		// one module into the quiet zone
+		timingLength := func(horizontal bool) int {
+			n := 8
+			for ; n < 19; n++ {
+				var p point
+				if horizontal {
+					p = module(float64(n), 0)
+				} else {
+					p = module(0, float64(n))
+				}
+
+				if b.atPoint(p) != (n%2 == 0) {
+					break
+				}
+			}
+
+			return n - 1
+		}
+
+		size := timingLength(true)
+		if size != timingLength(false) || size < 11 || size > 17 || size%2 == 0 {
+			continue
+		}
+
+		s := sampleSymbol(b, transform, size, size)
+		result, err := decodeMicroQRCode(s)
+		debug.addSymbol(b, transform, s, err)
+		if err != nil {
+			return QRCodeResult{}, err
+		}
+
+		result.Location = newLocation(transform, size, size)
+
+		return result, nil
+	}
+
+	return QRCodeResult{}, errors.New("could not find timing patterns of micro qr code")
+}
+
+// Read an image that is just a code and its quiet zone, which is upright or rotated by a multiple of 90 degrees.
+// If mirrored is set, it is also tried as a mirror image
+func readPureImage(b *bitmap, mirrored bool, debug *DebugInfo) (QRCodeResult, error) {
+	// Find the edges of the code from the dark pixels
+	minX, minY, maxX, maxY := b.width, b.height, -1, -1
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			if b.at(x, y) {
+				minX = int(math.Min(float64(minX), float64(x)))
+				minY = int(math.Min(float64(minY), float64(y)))
+				maxX = int(math.Max(float64(maxX), float64(x)))
+				maxY = int(math.Max(float64(maxY), float64(y)))
+			}
+		}
+	}
+	if maxX < 0 {
+		return QRCodeResult{}, errors.New("could not find qr code (the image is blank)")
+	}
+	width, height := float64(maxX-minX+1), float64(maxY-minY+1)
+
+	// The pixels along the edges from each corner with a finder pattern are dark for 7 modules
+	var moduleSizes []float64
+	for _, c := range [][4]int{{minX, minY, 1, 1}, {maxX, minY, -1, 1}, {maxX, maxY, -1, -1}, {minX, maxY, 1, -1}} {
+		across, down := 0, 0
+		for b.at(c[0]+across*c[2], c[1]) {
+			across++
+		}
+		for b.at(c[0], c[1]+down*c[3]) {
+			down++
+		}
+
+		if across > 0 && math.Abs(float64(across-down)) <= math.Max(float64(across), float64(down))/4 {
+			moduleSizes = append(moduleSizes, float64(across+down)/14)
+		}
+	}
+
+	// Orientations of the code, as where the top left corner is and which ways the axes go, in modules.
+	// Mirror images have their axes swapped
+	orientations := [][3]point{
+		{{0, 0}, {1, 0}, {0, 1}},
+		{{1, 0}, {0, 1}, {-1, 0}},
+		{{1, 1}, {-1, 0}, {0, -1}},
+		{{0, 1}, {0, -1}, {1, 0}},
+	}
+
+	firstErr := errors.New("could not find finder patterns of pure qr code")
+	for _, m := range moduleSizes {
+		// Qr codes are 4n+17 modules wide, and micro qr codes are odd widths from 11 to 17
+		dim := int(math.Round(width / m))
+		if dim >= 21 {
+			dim = int(math.Round(float64(dim-17)/4))*4 + 17
+		} else {
+			dim = int(math.Max(11, math.Min(17, float64(dim/2*2+1))))
+		}
+		if math.Abs(height/width*float64(dim)-float64(dim)) > 1 {
+			// The code has to be square
+			continue
+		}
+
+		size := float64(dim)
+		grid := affineHomography(point{float64(minX), float64(minY)}, point{width / size, 0}, point{0, height / size})
+
+		for _, mirror := range []bool{false, true} {
+			if mirror && !mirrored {
+				break
+			}
+
+			for _, o := range orientations {
+				xAxis, yAxis := o[1], o[2]
+				if mirror {
+					xAxis, yAxis = yAxis, xAxis
+				}
+				transform := grid.mul(affineHomography(o[0].scale(size), xAxis, yAxis))
+
+				s := sampleSymbol(b, transform, dim, dim)
+				var result QRCodeResult
+				var err error
+				if dim < 21 {
+					if !hasFinderPattern(s, 0, 0) {
+						continue
+					}
+					result, err = decodeMicroQRCode(s)
+				} else {
+					if !hasFinderPattern(s, 0, 0) || !hasFinderPattern(s, dim-7, 0) || !hasFinderPattern(s, 0, dim-7) {
+						continue
+					}
+					result, err = decodeQRCode(s, sampleConfidence(b, transform, dim, dim))
+				}
+				debug.addSymbol(b, transform, s, err)
+
+				if err != nil {
+					firstErr = err
+					continue
+				}
+
+				result.Location = newLocation(transform, dim, dim)
+				result.Mirrored = mirror
+				return result, nil
+			}
+		}
+	}
+
+	return QRCodeResult{}, firstErr
+}
+
+// Returns true if there is a finder pattern with its top left module at (x,y), allowing for a few wrong modules
+func hasFinderPattern(s *Symbol, x, y int) bool {
+	var wrong int
+	iterateRect(7, 7, func(dx, dy int) {
+		// The pattern is a dark ring, a light ring, and then a dark 3x3 square
+		ring := int(math.Max(math.Abs(float64(dx-3)), math.Abs(float64(dy-3))))
+		if s.Modules[y+dy][x+dx] != (ring != 2) {
+			wrong++
+		}
+	})
+
+	return wrong <= 4
+}
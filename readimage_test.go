@@ -0,0 +1,212 @@
+package polishedqr
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Create an image of a qr code for each payload, with modules scale pixels wide
+func testImages(t *testing.T, payloads []string, scale int) []*image.RGBA {
+	t.Helper()
+
+	var images []*image.RGBA
+	for _, v := range payloads {
+		s, err := Create([]byte(v), nil)
+		if err != nil {
+			t.Fatalf("error creating qr code for %q: %v", v, err)
+		}
+		images = append(images, s.Render(scale))
+	}
+
+	return images
+}
+
+// Render a symbol and read it back, failing the test if it can't be read
+func readSymbol(t *testing.T, s *Symbol, opts *ReadOptions) QRCodeResult {
+	t.Helper()
+
+	result, err := ReadFromImage(s.Render(4), opts)
+	if err != nil {
+		t.Fatalf("error reading code: %v", err)
+	}
+
+	return result
+}
+
+// Read different images from several goroutines at once, which should be run with -race
+func TestReadFromImageConcurrent(t *testing.T) {
+	var payloads []string
+	for i := 0; i < 8; i++ {
+		payloads = append(payloads, fmt.Sprintf("concurrent read %v", i))
+	}
+	images := testImages(t, payloads, 3)
+
+	var wg sync.WaitGroup
+	for k := range images {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+
+			for i := 0; i < 5; i++ {
+				result, err := ReadFromImage(images[k], nil)
+				if err != nil {
+					t.Errorf("error reading code %v: %v", k, err)
+					return
+				}
+				if string(result.Data) != payloads[k] {
+					t.Errorf("read %q from code %v, expected %q", result.Data, k, payloads[k])
+					return
+				}
+			}
+		}(k)
+	}
+
+	wg.Wait()
+}
+
+// Returns a copy of an image with dark and light swapped
+func invertImage(img *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Rect)
+	for k, v := range img.Pix {
+		if k%4 == 3 {
+			out.Pix[k] = v
+		} else {
+			out.Pix[k] = 255 - v
+		}
+	}
+
+	return out
+}
+
+// Returns a copy of an image flipped from left to right
+func mirrorImage(img *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Rect)
+	w := img.Rect.Dx()
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < w; x++ {
+			out.SetRGBA(w-1-x, y, img.RGBAAt(x, y))
+		}
+	}
+
+	return out
+}
+
+// Read codes that are light on dark, back to front, or both
+func TestReadInvertedMirrored(t *testing.T) {
+	data := "inverted and mirrored"
+	img := testImages(t, []string{data}, 4)[0]
+	micro, err := CreateMicro([]byte("12345"), nil)
+	if err != nil {
+		t.Fatalf("error creating micro qr code: %v", err)
+	}
+
+	for _, v := range []struct {
+		name     string
+		img      *image.RGBA
+		data     string
+		inverted bool
+		mirrored bool
+	}{
+		{"inverted", invertImage(img), data, true, false},
+		{"mirrored", mirrorImage(img), data, false, true},
+		{"inverted and mirrored", invertImage(mirrorImage(img)), data, true, true},
+		{"micro inverted", invertImage(micro.Render(4)), "12345", true, false},
+		{"micro mirrored", mirrorImage(micro.Render(4)), "12345", false, true},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			result, err := ReadFromImage(v.img, nil)
+			if err != nil {
+				t.Fatalf("error reading code: %v", err)
+			}
+			if string(result.Data) != v.data {
+				t.Fatalf("read %q, expected %q", result.Data, v.data)
+			}
+			if result.Inverted != v.inverted || result.Mirrored != v.mirrored {
+				t.Errorf("read as inverted %v and mirrored %v, expected %v and %v", result.Inverted, result.Mirrored, v.inverted, v.mirrored)
+			}
+
+			// Neither is tried when they are disabled
+			_, err = ReadFromImage(v.img, &ReadOptions{DisableInverted: v.inverted, DisableMirrored: v.mirrored})
+			if err == nil {
+				t.Errorf("read code with inverted %v and mirrored %v disabled", v.inverted, v.mirrored)
+			}
+		})
+	}
+}
+
+// Read every code in an image that is scattered with patterns that look like finder patterns,
+// which only form triples with each other that fail to decode
+func TestReadAllAmongFinders(t *testing.T) {
+	var payloads []string
+	for i := 0; i < 9; i++ {
+		payloads = append(payloads, fmt.Sprintf("code %v", i))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 1400, 1400))
+	draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+	for k, v := range testImages(t, payloads, 4) {
+		draw.Draw(img, v.Rect.Add(image.Pt(20+k%3*300, 20+k/3*300)), v, image.Point{}, draw.Src)
+	}
+
+	// Scatter finder patterns along the bottom and right of the image
+	finder := newSymbol(7, 7)
+	drawFinderPattern(finder, 0, 0)
+	finderImg := finder.Render(4)
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 100; i++ {
+		p := image.Pt(950+rng.Intn(400), rng.Intn(1350))
+		if i%2 == 0 {
+			p = image.Pt(rng.Intn(1350), 950+rng.Intn(400))
+		}
+		draw.Draw(img, finderImg.Rect.Add(p), finderImg, image.Point{}, draw.Src)
+	}
+
+	start := time.Now()
+	results, err := ReadAllFromImage(img, nil)
+	if err != nil {
+		t.Fatalf("error reading codes: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, v := range results {
+		found[string(v.Data)] = true
+	}
+	for _, v := range payloads {
+		if !found[v] {
+			t.Errorf("didn't read %q", v)
+		}
+	}
+
+	// Trying every triple of patterns took tens of seconds
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("reading took %v", d)
+	}
+}
+
+// Replace both copies of the version information with another valid version, as if
+// they had been smudged enough to be corrected to the wrong one. The code should
+// still be read using the version estimated from the finder patterns
+func TestReadWrongVersionInfo(t *testing.T) {
+	data := "the version information is wrong"
+	s, err := Create([]byte(data), &CreateOptions{Version: 7, ErrorCorrectionLevel: "M"})
+	if err != nil {
+		t.Fatalf("error creating code: %v", err)
+	}
+	addFormatAndVersionInfo(s, s.ErrorCorrectionLevel, s.Mask, 8)
+	if v := readVersionInfo(s); v != 8 {
+		t.Fatalf("version information reads as %v, expected 8", v)
+	}
+
+	result := readSymbol(t, s, nil)
+	if string(result.Data) != data {
+		t.Fatalf("read %q, expected %q", result.Data, data)
+	}
+	if result.Version != 7 {
+		t.Errorf("read version %v, expected 7", result.Version)
+	}
+}
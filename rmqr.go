@@ -0,0 +1,535 @@
+package polishedqr
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+type rmqrVersion struct {
+	width  int
+	height int
+
+	// The length of the character counts, in the order numeric, alphanumeric, bytes, kanji
+	countBits [4]int
+
+	// Rmqr codes only have error correction levels M and H
+	blocks map[string]ecBlocks
+}
+
+// Every size of rmqr code, from R7x43 to R17x139.
+// The index of each size is the version indicator stored in the format information.
+var rmqrVersions = []rmqrVersion{
+	{
+		width: 43, height: 7, countBits: [4]int{4, 3, 3, 2},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 7, blocks: []ecBlock{{count: 1, dataWords: 6}}},
+			"H": ecBlocks{ecWordsPerBlock: 10, blocks: []ecBlock{{count: 1, dataWords: 3}}},
+		},
+	},
+	{
+		width: 59, height: 7, countBits: [4]int{5, 5, 4, 3},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 9, blocks: []ecBlock{{count: 1, dataWords: 12}}},
+			"H": ecBlocks{ecWordsPerBlock: 14, blocks: []ecBlock{{count: 1, dataWords: 7}}},
+		},
+	},
+	{
+		width: 77, height: 7, countBits: [4]int{6, 5, 5, 4},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 12, blocks: []ecBlock{{count: 1, dataWords: 20}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 1, dataWords: 10}}},
+		},
+	},
+	{
+		width: 99, height: 7, countBits: [4]int{7, 6, 5, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 28}}},
+			"H": ecBlocks{ecWordsPerBlock: 30, blocks: []ecBlock{{count: 1, dataWords: 14}}},
+		},
+	},
+	{
+		width: 139, height: 7, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 12, blocks: []ecBlock{{count: 2, dataWords: 22}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 2, dataWords: 12}}},
+		},
+	},
+	{
+		width: 43, height: 9, countBits: [4]int{5, 5, 4, 3},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 9, blocks: []ecBlock{{count: 1, dataWords: 12}}},
+			"H": ecBlocks{ecWordsPerBlock: 14, blocks: []ecBlock{{count: 1, dataWords: 7}}},
+		},
+	},
+	{
+		width: 59, height: 9, countBits: [4]int{6, 5, 5, 4},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 12, blocks: []ecBlock{{count: 1, dataWords: 21}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 1, dataWords: 11}}},
+		},
+	},
+	{
+		width: 77, height: 9, countBits: [4]int{7, 6, 5, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 18, blocks: []ecBlock{{count: 1, dataWords: 31}}},
+			"H": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 8}, {count: 1, dataWords: 9}}},
+		},
+	},
+	{
+		width: 99, height: 9, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 1, dataWords: 42}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 2, dataWords: 11}}},
+		},
+	},
+	{
+		width: 139, height: 9, countBits: [4]int{8, 7, 6, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 18, blocks: []ecBlock{{count: 1, dataWords: 31}, {count: 1, dataWords: 32}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 3, dataWords: 11}}},
+		},
+	},
+	{
+		width: 27, height: 11, countBits: [4]int{4, 4, 3, 2},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 8, blocks: []ecBlock{{count: 1, dataWords: 7}}},
+			"H": ecBlocks{ecWordsPerBlock: 10, blocks: []ecBlock{{count: 1, dataWords: 5}}},
+		},
+	},
+	{
+		width: 43, height: 11, countBits: [4]int{6, 5, 5, 4},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 12, blocks: []ecBlock{{count: 1, dataWords: 19}}},
+			"H": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 1, dataWords: 11}}},
+		},
+	},
+	{
+		width: 59, height: 11, countBits: [4]int{7, 6, 5, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 31}}},
+			"H": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 7}, {count: 1, dataWords: 8}}},
+		},
+	},
+	{
+		width: 77, height: 11, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 1, dataWords: 43}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 1, dataWords: 11}, {count: 1, dataWords: 12}}},
+		},
+	},
+	{
+		width: 99, height: 11, countBits: [4]int{8, 7, 6, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 28}, {count: 1, dataWords: 29}}},
+			"H": ecBlocks{ecWordsPerBlock: 30, blocks: []ecBlock{{count: 1, dataWords: 14}, {count: 1, dataWords: 15}}},
+		},
+	},
+	{
+		width: 139, height: 11, countBits: [4]int{8, 7, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 2, dataWords: 42}}},
+			"H": ecBlocks{ecWordsPerBlock: 30, blocks: []ecBlock{{count: 3, dataWords: 14}}},
+		},
+	},
+	{
+		width: 27, height: 13, countBits: [4]int{5, 5, 4, 3},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 9, blocks: []ecBlock{{count: 1, dataWords: 12}}},
+			"H": ecBlocks{ecWordsPerBlock: 14, blocks: []ecBlock{{count: 1, dataWords: 7}}},
+		},
+	},
+	{
+		width: 43, height: 13, countBits: [4]int{6, 6, 5, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 14, blocks: []ecBlock{{count: 1, dataWords: 27}}},
+			"H": ecBlocks{ecWordsPerBlock: 28, blocks: []ecBlock{{count: 1, dataWords: 13}}},
+		},
+	},
+	{
+		width: 59, height: 13, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 1, dataWords: 38}}},
+			"H": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 2, dataWords: 10}}},
+		},
+	},
+	{
+		width: 77, height: 13, countBits: [4]int{7, 7, 6, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 1, dataWords: 26}, {count: 1, dataWords: 27}}},
+			"H": ecBlocks{ecWordsPerBlock: 28, blocks: []ecBlock{{count: 1, dataWords: 14}, {count: 1, dataWords: 15}}},
+		},
+	},
+	{
+		width: 99, height: 13, countBits: [4]int{8, 7, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 1, dataWords: 36}, {count: 1, dataWords: 37}}},
+			"H": ecBlocks{ecWordsPerBlock: 26, blocks: []ecBlock{{count: 1, dataWords: 11}, {count: 2, dataWords: 12}}},
+		},
+	},
+	{
+		width: 139, height: 13, countBits: [4]int{8, 8, 7, 7},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 2, dataWords: 35}, {count: 1, dataWords: 36}}},
+			"H": ecBlocks{ecWordsPerBlock: 28, blocks: []ecBlock{{count: 2, dataWords: 13}, {count: 2, dataWords: 14}}},
+		},
+	},
+	{
+		width: 43, height: 15, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 18, blocks: []ecBlock{{count: 1, dataWords: 33}}},
+			"H": ecBlocks{ecWordsPerBlock: 18, blocks: []ecBlock{{count: 1, dataWords: 7}, {count: 1, dataWords: 8}}},
+		},
+	},
+	{
+		width: 59, height: 15, countBits: [4]int{7, 7, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 26, blocks: []ecBlock{{count: 1, dataWords: 48}}},
+			"H": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 2, dataWords: 13}}},
+		},
+	},
+	{
+		width: 77, height: 15, countBits: [4]int{8, 7, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 18, blocks: []ecBlock{{count: 1, dataWords: 33}, {count: 1, dataWords: 34}}},
+			"H": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 2, dataWords: 10}, {count: 1, dataWords: 11}}},
+		},
+	},
+	{
+		width: 99, height: 15, countBits: [4]int{8, 7, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 2, dataWords: 44}}},
+			"H": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 4, dataWords: 12}}},
+		},
+	},
+	{
+		width: 139, height: 15, countBits: [4]int{9, 8, 7, 7},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 24, blocks: []ecBlock{{count: 2, dataWords: 42}, {count: 1, dataWords: 43}}},
+			"H": ecBlocks{ecWordsPerBlock: 26, blocks: []ecBlock{{count: 1, dataWords: 13}, {count: 4, dataWords: 14}}},
+		},
+	},
+	{
+		width: 43, height: 17, countBits: [4]int{7, 6, 6, 5},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 1, dataWords: 39}}},
+			"H": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 1, dataWords: 10}, {count: 1, dataWords: 11}}},
+		},
+	},
+	{
+		width: 59, height: 17, countBits: [4]int{8, 7, 6, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 16, blocks: []ecBlock{{count: 2, dataWords: 28}}},
+			"H": ecBlocks{ecWordsPerBlock: 30, blocks: []ecBlock{{count: 2, dataWords: 14}}},
+		},
+	},
+	{
+		width: 77, height: 17, countBits: [4]int{8, 7, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 22, blocks: []ecBlock{{count: 2, dataWords: 39}}},
+			"H": ecBlocks{ecWordsPerBlock: 28, blocks: []ecBlock{{count: 1, dataWords: 12}, {count: 2, dataWords: 13}}},
+		},
+	},
+	{
+		width: 99, height: 17, countBits: [4]int{8, 8, 7, 6},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 2, dataWords: 33}, {count: 1, dataWords: 34}}},
+			"H": ecBlocks{ecWordsPerBlock: 26, blocks: []ecBlock{{count: 4, dataWords: 14}}},
+		},
+	},
+	{
+		width: 139, height: 17, countBits: [4]int{9, 8, 8, 7},
+		blocks: map[string]ecBlocks{
+			"M": ecBlocks{ecWordsPerBlock: 20, blocks: []ecBlock{{count: 4, dataWords: 38}}},
+			"H": ecBlocks{ecWordsPerBlock: 26, blocks: []ecBlock{{count: 2, dataWords: 12}, {count: 4, dataWords: 13}}},
+		},
+	},
+}
+
+// The columns of the alignment patterns and vertical timing patterns, by width
+var rmqrAlignmentPositions = map[int][]int{
+	27:  {},
+	43:  {21},
+	59:  {19, 39},
+	77:  {25, 51},
+	99:  {23, 49, 75},
+	139: {27, 55, 83, 111},
+}
+
+func rmqrDataFormat(version int) dataFormat {
+	v := rmqrVersions[version]
+
+	// Mode indicators are 3 bits, and there is no structured append
+	return dataFormat{
+		modeBits: 3,
+		modes: map[CharacterSet]int{
+			Numeric:      0b001,
+			Alphanumeric: 0b010,
+			Bytes:        0b011,
+			Kanji:        0b100,
+		},
+		countBits: map[CharacterSet]int{
+			Numeric:      v.countBits[0],
+			Alphanumeric: v.countBits[1],
+			Bytes:        v.countBits[2],
+			Kanji:        v.countBits[3],
+		},
+		specialModes: map[int]specialMode{
+			0b111: eciMode,
+			0b101: fnc1FirstMode,
+			0b110: fnc1SecondMode,
+		},
+		terminatorBits: 3,
+	}
+}
+
+// Create a rectangular micro qr code (rMQR) from data with options, which may be nil.
+// Only error correction levels M and H can be used.
+// The version is the size from 1 (R7x43) to 32 (R17x139), in the order of the standard.
+// If unset, the narrowest code that fits the data and is no taller than MaxHeight will be used.
+func CreateRMQR(data []byte, opts *CreateOptions) (*Symbol, error) {
+	if opts != nil && opts.GS1 {
+		var err error
+		data, err = parseGS1Input(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return createRMQRCode(data, opts)
+}
+
+// Like CreateRMQR, but panics if the code can't be created
+func CreateRMQRCode(data []byte, opts *CreateOptions) *image.RGBA {
+	s, err := CreateRMQR(data, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return s.Render(1)
+}
+
+// Returns the versions (as indexes into rmqrVersions) that could be used, in order of preference
+func rmqrCandidates(opts *CreateOptions) ([]int, error) {
+	if opts.Version != 0 {
+		if opts.Version < 1 || opts.Version > len(rmqrVersions) {
+			return nil, fmt.Errorf("%w: rmqr codes are from version 1 to 32, not %v", ErrInvalidVersion, opts.Version)
+		}
+
+		return []int{opts.Version - 1}, nil
+	}
+
+	maxHeight := opts.MaxHeight
+	if maxHeight == 0 {
+		maxHeight = 17
+	}
+
+	var candidates []int
+	for k, v := range rmqrVersions {
+		if v.height <= maxHeight {
+			candidates = append(candidates, k)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no rmqr code is %v modules tall or less", ErrInvalidVersion, maxHeight)
+	}
+
+	// Prefer narrower codes, then shorter codes
+	sort.SliceStable(candidates, func(a, b int) bool {
+		va, vb := rmqrVersions[candidates[a]], rmqrVersions[candidates[b]]
+		if va.width != vb.width {
+			return va.width < vb.width
+		}
+		return va.height < vb.height
+	})
+
+	return candidates, nil
+}
+
+func createRMQRCode(data []byte, opts *CreateOptions) (*Symbol, error) {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+
+	if opts.ErrorCorrectionLevel == "" {
+		opts.ErrorCorrectionLevel = "M"
+	}
+
+	if opts.ErrorCorrectionLevel != "M" && opts.ErrorCorrectionLevel != "H" {
+		return nil, fmt.Errorf("%w %q: rmqr codes can only use M and H", ErrInvalidECLevel, opts.ErrorCorrectionLevel)
+	}
+
+	candidates, err := rmqrCandidates(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the first candidate that fits the data
+	version := -1
+	var dataBits Bits
+	for _, v := range candidates {
+		format := rmqrDataFormat(v)
+
+		// Encode data
+		var segments []segment
+		if opts.CharacterSet != nil {
+			segments = []segment{{mode: *opts.CharacterSet, data: data}}
+		} else if opts.DisableSegmentation {
+			segments = []segment{{mode: AutodetectCharacterSet(data), data: data}}
+		} else {
+			segments = segmentData(data, format, opts.GS1)
+		}
+
+		dataBits, err = encodeDataSegments(segments, opts, format, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Check whether the data fits
+		if len(dataBits) <= rmqrDataWords(v, opts.ErrorCorrectionLevel)*8 {
+			version = v
+			break
+		}
+	}
+
+	if version < 0 {
+		// The last candidate is the largest
+		return nil, &DataTooLargeError{
+			Required:  len(dataBits),
+			Available: rmqrDataWords(candidates[len(candidates)-1], opts.ErrorCorrectionLevel) * 8,
+			Symbol:    "rmqr code",
+		}
+	}
+
+	// Generate error correction
+	codewords := toCodewords(dataBits, rmqrDataWords(version, opts.ErrorCorrectionLevel)*8, 3)
+	allwords := generateBlockErrorWords(codewords, rmqrVersions[version].blocks[opts.ErrorCorrectionLevel])
+
+	s := newRMQRSymbol(version)
+	s.ErrorCorrectionLevel = opts.ErrorCorrectionLevel
+	addRMQRFormatInfo(s, opts.ErrorCorrectionLevel, version)
+
+	// Draw the data with a zig-zag pattern, starting left of the timing pattern on the right edge
+	var bits Bits
+	for _, v := range allwords {
+		bits = append(bits, toBits(int(v), 8)...)
+	}
+	writeBits(s, bits, s.Width()-1)
+
+	// Rmqr codes always use the same mask
+	s.Mask = 4
+	applyMask(s, Masks[s.Mask])
+
+	return s, nil
+}
+
+// Returns an empty rmqr code with its function patterns drawn,
+// where version is an index into rmqrVersions
+func newRMQRSymbol(version int) *Symbol {
+	s := newSymbol(rmqrVersions[version].width, rmqrVersions[version].height)
+	s.Version = version + 1
+	s.RMQR = true
+
+	drawRMQRFunctionPatterns(s)
+
+	// Reserve the format information, which is written once the ec level is known
+	addRMQRFormatInfo(s, "M", version)
+
+	return s
+}
+
+// Returns the number of data codewords in a version of rmqr code
+func rmqrDataWords(version int, ecLevel string) int {
+	var total int
+	for _, v := range rmqrVersions[version].blocks[ecLevel].blocks {
+		total += v.dataWords * v.count
+	}
+
+	return total
+}
+
+func drawRMQRFunctionPatterns(s *Symbol) {
+	w := s.Width()
+	h := s.Height()
+
+	// Draw the finder pattern in the top left, and the smaller sub pattern in the bottom right
+	drawFinderPattern(s, 0, 0)
+	drawAlignmentPattern(s, w-5, h-5)
+
+	// Draw the corner finder patterns in the top right and bottom left
+	s.setFunction(w-1, 0, true)
+	s.setFunction(w-2, 0, true)
+	s.setFunction(w-1, 1, true)
+	s.setFunction(w-2, 1, false)
+	s.setFunction(w-1, 2, true)
+
+	s.setFunction(0, h-1, true)
+	s.setFunction(1, h-1, true)
+	s.setFunction(2, h-1, true)
+	if h >= 11 {
+		// Shorter codes have the finder pattern here instead
+		s.setFunction(0, h-2, true)
+		s.setFunction(1, h-2, false)
+	}
+
+	// Draw the alignment patterns on the top and bottom edges
+	for _, v := range rmqrAlignmentPositions[w] {
+		iterateRect(3, 3, func(x, y int) {
+			s.setFunction(v+x-1, y, true)
+			s.setFunction(v+x-1, h-1-y, true)
+		})
+		s.setFunction(v, 1, false)
+		s.setFunction(v, h-2, false)
+	}
+
+	// Draw the timing patterns along the edges and through the alignment patterns,
+	// around the patterns that are already there
+	for x := 0; x < w; x++ {
+		for _, y := range []int{0, h - 1} {
+			if !s.isFunction(x, y) {
+				s.setFunction(x, y, x%2 == 0)
+			}
+		}
+	}
+
+	columns := append([]int{0, w - 1}, rmqrAlignmentPositions[w]...)
+	for y := 0; y < h; y++ {
+		for _, x := range columns {
+			if !s.isFunction(x, y) {
+				s.setFunction(x, y, y%2 == 0)
+			}
+		}
+	}
+}
+
+func addRMQRFormatInfo(s *Symbol, ecLevel string, version int) {
+	// Generate 18 bits of format info
+	code := version
+	if ecLevel == "H" {
+		code |= 1 << 5
+	}
+	encodedFormat := (code << 12) | checkVersion(code<<12)
+
+	// Each copy of the format information is masked differently
+	left := formatModules(encodedFormat^0b011111101010110010, 18)
+	right := formatModules(encodedFormat^0b100000101001111011, 18)
+
+	// Write format info (right of the finder pattern)
+	for k := 0; k < 15; k++ {
+		s.setFunction(8+k/5, 1+k%5, left[k])
+	}
+	for k := 15; k < 18; k++ {
+		s.setFunction(11, k-14, left[k])
+	}
+
+	// Write format info (left of the finder sub pattern)
+	w := s.Width()
+	h := s.Height()
+	for k := 0; k < 15; k++ {
+		s.setFunction(w-8+k/5, h-6+k%5, right[k])
+	}
+	for k := 15; k < 18; k++ {
+		s.setFunction(w-20+k, h-6, right[k])
+	}
+}
@@ -0,0 +1,136 @@
+package polishedqr
+
+import "testing"
+
+// Check where the function patterns of the smallest and largest rmqr codes are placed,
+// and that both copies of the format information hold the version and ec level
+func TestRMQRLayout(t *testing.T) {
+	for _, v := range []struct {
+		name       string
+		version    int
+		ecLevel    string
+		width      int
+		height     int
+		alignments []int
+
+		// The format information before it is masked
+		format int
+	}{
+		{"R7x43-M", 1, "M", 43, 7, []int{21}, 0b000000000000000000},
+		{"R7x43-H", 1, "H", 43, 7, []int{21}, 0b100000100111010101},
+		{"R17x139-M", 32, "M", 139, 17, []int{27, 55, 83, 111}, 0b011111001001010000},
+		{"R17x139-H", 32, "H", 139, 17, []int{27, 55, 83, 111}, 0b111111101110000101},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			s, err := CreateRMQR([]byte("1"), &CreateOptions{Version: v.version, ErrorCorrectionLevel: v.ecLevel})
+			if err != nil {
+				t.Fatalf("error creating rmqr code: %v", err)
+			}
+			w, h := s.Width(), s.Height()
+			if w != v.width || h != v.height {
+				t.Fatalf("code is %vx%v, expected %vx%v", w, h, v.width, v.height)
+			}
+
+			checkModule := func(x, y int, dark bool, what string) {
+				t.Helper()
+				if !s.isFunction(x, y) {
+					t.Errorf("%v at (%v, %v) isn't a function module", what, x, y)
+				} else if s.Dark(x, y) != dark {
+					t.Errorf("%v at (%v, %v) is dark %v, expected %v", what, x, y, s.Dark(x, y), dark)
+				}
+			}
+
+			// Read a copy of the format information, most significant bit first
+			readFormat := func(modules [][2]int, mask int) int {
+				var format int
+				for _, m := range modules {
+					if !s.isFunction(m[0], m[1]) {
+						t.Errorf("format information at (%v, %v) isn't a function module", m[0], m[1])
+					}
+
+					format <<= 1
+					if s.Dark(m[0], m[1]) {
+						format |= 1
+					}
+				}
+				return format ^ mask
+			}
+
+			// Right of the finder pattern
+			var left [][2]int
+			for y := 3; y >= 1; y-- {
+				left = append(left, [2]int{11, y})
+			}
+			for x := 10; x >= 8; x-- {
+				for y := 5; y >= 1; y-- {
+					left = append(left, [2]int{x, y})
+				}
+			}
+			if f := readFormat(left, 0b011111101010110010); f != v.format {
+				t.Errorf("format information by the finder pattern is %018b, expected %018b", f, v.format)
+			}
+
+			// Left of the finder sub pattern
+			var right [][2]int
+			for x := 3; x <= 5; x++ {
+				right = append(right, [2]int{w - x, h - 6})
+			}
+			for x := 6; x <= 8; x++ {
+				for y := 2; y <= 6; y++ {
+					right = append(right, [2]int{w - x, h - y})
+				}
+			}
+			if f := readFormat(right, 0b100000101001111011); f != v.format {
+				t.Errorf("format information by the finder sub pattern is %018b, expected %018b", f, v.format)
+			}
+
+			// The finder sub pattern in the bottom right
+			checkModule(w-3, h-3, true, "finder sub pattern centre")
+			checkModule(w-4, h-4, false, "finder sub pattern ring")
+			checkModule(w-5, h-5, true, "finder sub pattern edge")
+
+			// The alignment patterns on the top and bottom edges have a light centre
+			for _, x := range v.alignments {
+				for dx := -1; dx <= 1; dx++ {
+					for dy := 0; dy < 3; dy++ {
+						centre := dx == 0 && dy == 1
+						checkModule(x+dx, dy, !centre, "top alignment pattern")
+						checkModule(x+dx, h-1-dy, !centre, "bottom alignment pattern")
+					}
+				}
+
+				// With a vertical timing pattern between them
+				for y := 3; y < h-3; y++ {
+					checkModule(x, y, y%2 == 0, "vertical timing pattern")
+				}
+			}
+
+			// The timing patterns along the top and bottom edges, between the other patterns
+			isAlignment := func(x int) bool {
+				for _, a := range v.alignments {
+					if x >= a-1 && x <= a+1 {
+						return true
+					}
+				}
+				return false
+			}
+			for x := 8; x < w-5; x++ {
+				if isAlignment(x) {
+					continue
+				}
+				checkModule(x, 0, x%2 == 0, "top timing pattern")
+				checkModule(x, h-1, x%2 == 0, "bottom timing pattern")
+			}
+
+			// The corner finder pattern in the top right, and in the bottom left when the finder pattern isn't there
+			checkModule(w-2, 0, true, "corner finder pattern")
+			checkModule(w-2, 1, false, "corner finder pattern")
+			checkModule(w-1, 1, true, "corner finder pattern")
+			if h >= 11 {
+				checkModule(1, h-1, true, "corner finder pattern")
+				checkModule(1, h-2, false, "corner finder pattern")
+				checkModule(0, h-2, true, "corner finder pattern")
+			}
+		})
+	}
+}
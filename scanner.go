@@ -0,0 +1,186 @@
+//go:build gocv
+
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// The cooldown used when none is given
+const defaultCooldown = 2 * time.Second
+
+// Keeps reading codes from a camera or video file, sending each new one on a channel.
+// This uses OpenCV, so it is only built with the gocv build tag.
+type Scanner struct {
+	capture *gocv.VideoCapture
+	reader  *Reader
+	opts    *ReadOptions
+	results chan QRCodeResult
+
+	// The time of the current frame
+	clock func() time.Duration
+
+	// Set for cameras, which skip empty frames instead of stopping at them
+	live bool
+
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// Start scanning from a camera, using the device and frame rate in opts.
+// opts may be nil to use the first camera and the defaults
+func NewScanner(opts *ReadOptions) (*Scanner, error) {
+	device := 0
+	if opts != nil {
+		device = opts.Device
+	}
+
+	capture, err := gocv.VideoCaptureDevice(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open camera: %v", err)
+	}
+	capture.Set(gocv.VideoCaptureFPS, opts.frameRate())
+
+	start := time.Now()
+	return newScanner(capture, opts, func() time.Duration {
+		return time.Since(start)
+	}, true), nil
+}
+
+// Start scanning every frame of a video file, such as a recording for testing.
+// The cooldown is measured in video time, so files scan the same way however fast they are read.
+// The results channel is closed at the end of the video
+func NewVideoScanner(path string, opts *ReadOptions) (*Scanner, error) {
+	capture, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open video: %v", err)
+	}
+
+	return newScanner(capture, opts, func() time.Duration {
+		return time.Duration(capture.Get(gocv.VideoCapturePosMsec) * float64(time.Millisecond))
+	}, false), nil
+}
+
+func newScanner(capture *gocv.VideoCapture, opts *ReadOptions, clock func() time.Duration, live bool) *Scanner {
+	s := &Scanner{
+		capture: capture,
+		reader:  NewReader(opts, false),
+		opts:    opts,
+		results: make(chan QRCodeResult),
+		clock:   clock,
+		live:    live,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go s.scan()
+
+	return s
+}
+
+// The codes that have been read. A code is only sent again once it has been out of sight
+// for the cooldown. The channel is closed when the scanner stops
+func (s *Scanner) Results() <-chan QRCodeResult {
+	return s.results
+}
+
+// Returns why the scanner stopped by itself, such as the camera being unplugged.
+// It is nil while scanning, at the end of a video, and after Close
+func (s *Scanner) Err() error {
+	select {
+	case <-s.stopped:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Stop scanning and release the camera or video file
+func (s *Scanner) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+
+		// Wait for the current frame, so the capture isn't closed while it is being read
+		<-s.stopped
+		err = s.capture.Close()
+		if closeErr := s.reader.Close(); err == nil {
+			err = closeErr
+		}
+	})
+
+	return err
+}
+
+func (s *Scanner) scan() {
+	defer close(s.stopped)
+	defer close(s.results)
+
+	img := gocv.NewMat()
+	defer img.Close()
+
+	cooldown := defaultCooldown
+	if s.opts != nil && s.opts.Cooldown != 0 {
+		cooldown = s.opts.Cooldown
+	}
+
+	// When each payload was last seen
+	lastSeen := make(map[string]time.Duration)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		if !s.capture.Read(&img) || img.Empty() {
+			if !s.live {
+				// The end of the video
+				return
+			}
+
+			if !s.capture.IsOpened() {
+				s.err = errors.New("camera was closed")
+				return
+			}
+
+			// Cameras often send empty frames while they are warming up
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		now := s.clock()
+
+		// Forget codes that have been gone long enough to be sent again
+		for k, v := range lastSeen {
+			if now-v >= cooldown {
+				delete(lastSeen, k)
+			}
+		}
+
+		result, err := s.reader.Read(img)
+		if err != nil {
+			continue
+		}
+
+		payload := string(result.Data)
+		_, seen := lastSeen[payload]
+		lastSeen[payload] = now
+		if seen {
+			continue
+		}
+
+		select {
+		case s.results <- result:
+		case <-s.done:
+			return
+		}
+	}
+}
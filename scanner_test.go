@@ -0,0 +1,138 @@
+//go:build gocv
+
+package polishedqr
+
+import (
+	"image"
+	"image/draw"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// The frame rate and size of the test video
+const (
+	testVideoFPS  = 10
+	testVideoSize = 400
+)
+
+// Write a video with a code for each payload held in front of the camera for a number of frames.
+// An empty payload is a blank frame
+func writeTestVideo(t *testing.T, scenes []struct {
+	payload string
+	frames  int
+}) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "scan.avi")
+	w, err := gocv.VideoWriterFile(path, "MJPG", testVideoFPS, testVideoSize, testVideoSize, true)
+	if err != nil {
+		t.Fatalf("error creating video: %v", err)
+	}
+	defer w.Close()
+
+	for _, v := range scenes {
+		frame := image.NewRGBA(image.Rect(0, 0, testVideoSize, testVideoSize))
+		draw.Draw(frame, frame.Rect, image.White, image.Point{}, draw.Src)
+		if v.payload != "" {
+			code := testImages(t, []string{v.payload}, 8)[0]
+			draw.Draw(frame, code.Rect.Add(image.Pt(20, 20)), code, image.Point{}, draw.Src)
+		}
+
+		m, err := gocv.ImageToMatRGB(frame)
+		if err != nil {
+			t.Fatalf("error converting frame: %v", err)
+		}
+		for i := 0; i < v.frames; i++ {
+			if err := w.Write(m); err != nil {
+				t.Fatalf("error writing frame: %v", err)
+			}
+		}
+		m.Close()
+	}
+
+	return path
+}
+
+func TestScannerVideo(t *testing.T) {
+	path := writeTestVideo(t, []struct {
+		payload string
+		frames  int
+	}{
+		{"first", 10},
+		{"", 3},
+
+		// Back within the cooldown, so it isn't sent again
+		{"first", 10},
+		{"second", 10},
+		{"", 15},
+
+		// Gone for longer than the cooldown
+		{"first", 10},
+	})
+
+	s, err := NewVideoScanner(path, &ReadOptions{Cooldown: time.Second})
+	if err != nil {
+		t.Fatalf("error opening video: %v", err)
+	}
+	defer s.Close()
+
+	var got []string
+	for result := range s.Results() {
+		got = append(got, string(result.Data))
+	}
+
+	expected := []string{"first", "second", "first"}
+	if len(got) != len(expected) {
+		t.Fatalf("read %q, expected %q", got, expected)
+	}
+	for k := range expected {
+		if got[k] != expected[k] {
+			t.Fatalf("read %q, expected %q", got, expected)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		t.Errorf("error at the end of the video: %v", err)
+	}
+}
+
+func TestScannerClose(t *testing.T) {
+	path := writeTestVideo(t, []struct {
+		payload string
+		frames  int
+	}{
+		{"first", 5},
+		{"", 5},
+		{"second", 5},
+	})
+
+	s, err := NewVideoScanner(path, &ReadOptions{Cooldown: time.Second})
+	if err != nil {
+		t.Fatalf("error opening video: %v", err)
+	}
+
+	// Stop scanning without reading the second code
+	if result, ok := <-s.Results(); !ok || string(result.Data) != "first" {
+		t.Fatalf("read %q, expected %q", result.Data, "first")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing scanner: %v", err)
+	}
+
+	select {
+	case result, ok := <-s.Results():
+		if ok {
+			t.Errorf("read %q after closing", result.Data)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("results channel wasn't closed")
+	}
+
+	// Closing again does nothing
+	if err := s.Close(); err != nil {
+		t.Errorf("error closing scanner twice: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package polishedqr
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// A run of data that is encoded with a single character set
+type segment struct {
+	mode CharacterSet
+	data []byte
+}
+
+var segmentModes = []CharacterSet{Numeric, Alphanumeric, Bytes, Kanji}
+
+// Split data into segments of different character sets, choosing the split
+// that encodes to the fewest bits in this format.
+// Since the size of the character count changes between versions, so can the best split.
+// In FNC1 mode, GS1 separators can also be encoded as alphanumeric characters.
+func segmentData(data []byte, format dataFormat, fnc1 bool) []segment {
+	if len(data) == 0 {
+		return nil
+	}
+
+	// All costs are measured in sixths of a bit, so that the cost of a numeric (10/3 bits)
+	// or alphanumeric (11/2 bits) character is an integer
+	var headerCosts [4]int
+	for k, v := range segmentModes {
+		headerCosts[k] = (format.modeBits + format.countBits[v]) * 6
+	}
+
+	// Split data into characters
+	var chars [][]byte
+	for i := 0; i < len(data); {
+		_, size := utf8.DecodeRune(data[i:])
+		chars = append(chars, data[i:i+size])
+		i += size
+	}
+
+	// For each character, and each mode we could be in after that character,
+	// store the mode that character was encoded with (-1 if it can't be)
+	charModes := make([][4]CharacterSet, len(chars))
+
+	// The cost of each mode, starting with just the header of the first segment
+	prevCosts := headerCosts
+	for i, c := range chars {
+		var curCosts [4]int
+		for k, v := range segmentModes {
+			cost := charCost(c, v, fnc1)
+			if _, ok := format.modes[v]; !ok {
+				// The symbol doesn't support this character set
+				cost = -1
+			}
+
+			if cost < 0 {
+				charModes[i][k] = -1
+				curCosts[k] = math.MaxInt / 2
+				continue
+			}
+
+			charModes[i][k] = v
+			curCosts[k] = prevCosts[k] + cost
+		}
+
+		// Try starting a new segment after this character
+		for to := range segmentModes {
+			for from, fromMode := range segmentModes {
+				if charModes[i][from] < 0 {
+					continue
+				}
+
+				// Segments end on a whole bit
+				cost := (curCosts[from]+5)/6*6 + headerCosts[to]
+				if charModes[i][to] < 0 || cost < curCosts[to] {
+					curCosts[to] = cost
+					charModes[i][to] = fromMode
+				}
+			}
+		}
+
+		prevCosts = curCosts
+	}
+
+	// Find the cheapest mode to end in
+	end := 0
+	for k := range segmentModes {
+		if prevCosts[k] < prevCosts[end] {
+			end = k
+		}
+	}
+
+	if charModes[len(chars)-1][end] < 0 {
+		// Some characters can't be encoded by any character set this symbol supports
+		return nil
+	}
+
+	// Walk backwards to find the mode of each character
+	modes := make([]CharacterSet, len(chars))
+	mode := segmentModes[end]
+	for i := len(chars) - 1; i >= 0; i-- {
+		for k, v := range segmentModes {
+			if v == mode {
+				mode = charModes[i][k]
+				break
+			}
+		}
+		modes[i] = mode
+	}
+
+	// Join consecutive characters of the same mode into segments
+	var segments []segment
+	for i, c := range chars {
+		if len(segments) > 0 && segments[len(segments)-1].mode == modes[i] {
+			segments[len(segments)-1].data = append(segments[len(segments)-1].data, c...)
+		} else {
+			segments = append(segments, segment{mode: modes[i], data: append([]byte{}, c...)})
+		}
+	}
+
+	return segments
+}
+
+// Returns the cost of a character in a mode in sixths of a bit, or -1 if it can't be encoded
+func charCost(c []byte, mode CharacterSet, fnc1 bool) int {
+	switch mode {
+	case Numeric:
+		if len(c) == 1 && c[0] >= '0' && c[0] <= '9' {
+			return 20
+		}
+	case Alphanumeric:
+		if len(c) > 1 {
+			break
+		} else if fnc1 && c[0] == '%' {
+			// Literal % has to be escaped
+			return 66
+		} else if _, ok := alphanumericTable[c[0]]; ok || (fnc1 && c[0] == gs1Separator) {
+			return 33
+		}
+	case Bytes:
+		return len(c) * 8 * 6
+	case Kanji:
+		r, _ := utf8.DecodeRune(c)
+		if _, ok := shiftJISTable[r]; ok {
+			return 78
+		}
+	}
+
+	return -1
+}
+
+// Encode each segment in turn, returning an error if a character can't be encoded
+func encodeSegments(segments []segment, format dataFormat, fnc1 bool) (Bits, error) {
+	var b Bits
+	for _, v := range segments {
+		data := v.data
+		if v.mode == Alphanumeric && fnc1 {
+			data = escapeFNC1(data)
+		}
+
+		bits, err := convertSegment(v.mode, data, format)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, bits...)
+	}
+
+	return b, nil
+}
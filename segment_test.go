@@ -0,0 +1,46 @@
+package polishedqr
+
+import "testing"
+
+// Create codes that mix character sets and read them back, checking that the data was split
+// into the expected segments and that the code is no larger than without segmentation
+func TestSegmentationRoundTrip(t *testing.T) {
+	for _, v := range []struct {
+		data     string
+		expected []CharacterSet
+	}{
+		{"0123456789012345678901234567890123456789abcdefgh", []CharacterSet{Numeric, Bytes}},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789012345678901234567890123456789", []CharacterSet{Alphanumeric, Numeric}},
+		{"hello 0123456789012345678 WORLD", []CharacterSet{Bytes, Numeric, Alphanumeric}},
+		{"ABCDEF漢字漢字漢字012345678901234567", []CharacterSet{Alphanumeric, Kanji, Numeric}},
+	} {
+		t.Run(v.data, func(t *testing.T) {
+			s, err := Create([]byte(v.data), nil)
+			if err != nil {
+				t.Fatalf("error creating code: %v", err)
+			}
+
+			result := readSymbol(t, s, nil)
+			if string(result.Data) != v.data {
+				t.Fatalf("read %q, expected %q", result.Data, v.data)
+			}
+
+			if len(result.Segments) != len(v.expected) {
+				t.Fatalf("read %v segments, expected %v", len(result.Segments), len(v.expected))
+			}
+			for k, seg := range result.Segments {
+				if seg.CharacterSet != v.expected[k] {
+					t.Errorf("segment %v is character set %v, expected %v", k, seg.CharacterSet, v.expected[k])
+				}
+			}
+
+			single, err := Create([]byte(v.data), &CreateOptions{DisableSegmentation: true})
+			if err != nil {
+				t.Fatalf("error creating code without segmentation: %v", err)
+			}
+			if s.Width() > single.Width() {
+				t.Errorf("segmented code is %v modules wide, but %v without segmentation", s.Width(), single.Width())
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package polishedqr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"unicode/utf8"
+)
+
+// Create a sequence of up to 16 qr codes that hold data between them, using structured append.
+// Every code is created with opts, which may be nil. If the version is unset,
+// each code will be the smallest that can fit its part of the data.
+// Each image has one pixel per module, like CreateQRCode.
+func CreateStructuredAppend(data []byte, opts *CreateOptions) ([]*image.RGBA, error) {
+	symbols, err := CreateStructuredAppendSymbols(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*image.RGBA
+	for _, v := range symbols {
+		out = append(out, v.Render(1))
+	}
+
+	return out, nil
+}
+
+// Like CreateStructuredAppend, but returns the symbols so they can be rendered at any size
+func CreateStructuredAppendSymbols(data []byte, opts *CreateOptions) ([]*Symbol, error) {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+
+	if opts.ErrorCorrectionLevel == "" {
+		opts.ErrorCorrectionLevel = "M"
+	}
+
+	if opts.GS1 {
+		var err error
+		data, err = parseGS1Input(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The parity of the sequence is every byte of the data xored together
+	var parity byte
+	for _, v := range data {
+		parity ^= v
+	}
+
+	// Split into more and more symbols until every part fits
+	var tooLarge error
+	for total := 1; total <= 16; total++ {
+		parts := splitData(data, total)
+
+		// Check whether the parts fit in the largest allowed symbol
+		fitOpts := *opts
+		if fitOpts.Version == 0 {
+			fitOpts.Version = 40
+		}
+
+		tooLarge = nil
+		for k, v := range parts {
+			_, _, _, err := encodeData(v, &fitOpts, structuredAppendHeader(k, total, parity))
+			if errors.Is(err, ErrDataTooLarge) {
+				tooLarge = err
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		if tooLarge != nil {
+			continue
+		}
+
+		// Create each symbol in the sequence
+		var out []*Symbol
+		for k, v := range parts {
+			s, err := createQRCode(v, opts, structuredAppendHeader(k, total, parity))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("data cannot fit in 16 qr codes: %w", tooLarge)
+}
+
+// Returns the structured append header of a symbol, including the mode indicator
+func structuredAppendHeader(index, total int, parity byte) Bits {
+	var b Bits
+
+	// Add mode indicator
+	b = append(b, Bits{0, 0, 1, 1}...)
+
+	// Add the index of the symbol, the index of the last symbol and the parity
+	for i := 3; i >= 0; i-- {
+		b = append(b, uint8((index&(1<<i))>>i))
+	}
+	for i := 3; i >= 0; i-- {
+		b = append(b, uint8(((total-1)&(1<<i))>>i))
+	}
+	for i := 7; i >= 0; i-- {
+		b = append(b, (parity&(1<<i))>>i)
+	}
+
+	return b
+}
+
+// Split data into parts of roughly equal length, without splitting utf-8 characters
+func splitData(data []byte, total int) [][]byte {
+	var parts [][]byte
+	var start int
+	for i := 1; i <= total; i++ {
+		end := len(data) * i / total
+		for end < len(data) && end > start && !utf8.RuneStart(data[end]) {
+			end++
+		}
+
+		parts = append(parts, data[start:end])
+		start = end
+	}
+
+	return parts
+}
+
+// Collects the symbols of structured append sequences, in any order,
+// and rebuilds the data of a sequence once all of its symbols have been added.
+// The zero value is ready to use.
+type StructuredAppendAssembler struct {
+	sequences map[byte][]*QRCodeResult
+}
+
+// Add a symbol to its sequence. If the sequence is now complete, its data is returned
+// and complete is true. Symbols that aren't part of a sequence are complete on their own.
+func (a *StructuredAppendAssembler) Add(result QRCodeResult) (data []byte, complete bool, err error) {
+	info := result.StructuredAppend
+	if info == nil {
+		return result.Data, true, nil
+	}
+
+	if info.Index >= info.Total {
+		return nil, false, fmt.Errorf("symbol index %v is outside of sequence of %v", info.Index, info.Total)
+	}
+
+	if a.sequences == nil {
+		a.sequences = make(map[byte][]*QRCodeResult)
+	}
+
+	// Sequences are identified by their parity
+	seq, ok := a.sequences[info.Parity]
+	if !ok {
+		seq = make([]*QRCodeResult, info.Total)
+		a.sequences[info.Parity] = seq
+	} else if len(seq) != info.Total {
+		return nil, false, fmt.Errorf("symbol is part of a sequence of %v, expected %v", info.Total, len(seq))
+	}
+
+	seq[info.Index] = &result
+
+	// Check whether every symbol has arrived
+	for _, v := range seq {
+		if v == nil {
+			return nil, false, nil
+		}
+	}
+
+	for _, v := range seq {
+		data = append(data, v.Data...)
+	}
+	delete(a.sequences, info.Parity)
+
+	return data, true, nil
+}
@@ -0,0 +1,52 @@
+package polishedqr
+
+import (
+	"strings"
+	"testing"
+)
+
+// Split data across a sequence of codes, read them back out of order and rebuild the data
+func TestStructuredAppendRoundTrip(t *testing.T) {
+	for _, data := range []string{
+		strings.Repeat("structured append ", 10),
+		strings.Repeat("ünïcödé ", 12),
+	} {
+		symbols, err := CreateStructuredAppendSymbols([]byte(data), &CreateOptions{Version: 3})
+		if err != nil {
+			t.Fatalf("error creating sequence: %v", err)
+		}
+		if len(symbols) < 2 {
+			t.Fatalf("data was split into %v symbols, expected more", len(symbols))
+		}
+
+		var a StructuredAppendAssembler
+		for i := len(symbols) - 1; i >= 0; i-- {
+			result := readSymbol(t, symbols[i], nil)
+			if info := result.StructuredAppend; info == nil || info.Index != i || info.Total != len(symbols) {
+				t.Fatalf("symbol %v has structured append info %+v, expected index %v of %v", i, info, i, len(symbols))
+			}
+
+			out, complete, err := a.Add(result)
+			if err != nil {
+				t.Fatalf("error adding symbol %v: %v", i, err)
+			}
+			if complete != (i == 0) {
+				t.Fatalf("sequence complete is %v after adding symbol %v", complete, i)
+			}
+			if complete && string(out) != data {
+				t.Fatalf("rebuilt %q, expected %q", out, data)
+			}
+		}
+	}
+
+	// Symbols that aren't part of a sequence are complete on their own
+	s, err := Create([]byte("alone"), nil)
+	if err != nil {
+		t.Fatalf("error creating code: %v", err)
+	}
+
+	var a StructuredAppendAssembler
+	if out, complete, err := a.Add(readSymbol(t, s, nil)); err != nil || !complete || string(out) != "alone" {
+		t.Errorf("adding a lone symbol returned %q, %v, %v", out, complete, err)
+	}
+}
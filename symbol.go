@@ -0,0 +1,128 @@
+package polishedqr
+
+import (
+	"image"
+	"image/color"
+)
+
+// A code as a grid of modules, which can be rendered at any scale
+type Symbol struct {
+	// The modules of the code, indexed by [y][x], where true is dark.
+	// The quiet zone isn't included
+	Modules [][]bool
+
+	// Marks the modules that are part of function patterns (such as finder patterns
+	// and format information), rather than data. These are never masked
+	Function [][]bool
+
+	// For micro qr codes, versions 1 to 4 are M1 to M4.
+	// For rmqr codes, versions 1 to 32 are R7x43 to R17x139
+	Version int
+
+	ErrorCorrectionLevel string
+
+	// The index of the mask pattern that was applied
+	Mask int
+
+	// Set if the code is a micro qr code or rmqr code
+	Micro bool
+	RMQR  bool
+}
+
+func newSymbol(width, height int) *Symbol {
+	s := &Symbol{
+		Modules:  make([][]bool, height),
+		Function: make([][]bool, height),
+	}
+
+	for y := 0; y < height; y++ {
+		s.Modules[y] = make([]bool, width)
+		s.Function[y] = make([]bool, width)
+	}
+
+	return s
+}
+
+// The width of the code in modules, without the quiet zone
+func (s *Symbol) Width() int {
+	if len(s.Modules) == 0 {
+		return 0
+	}
+
+	return len(s.Modules[0])
+}
+
+// The height of the code in modules, without the quiet zone
+func (s *Symbol) Height() int {
+	return len(s.Modules)
+}
+
+// Returns true if the module is dark. Modules outside of the code are light
+func (s *Symbol) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= s.Width() || y >= s.Height() {
+		return false
+	}
+
+	return s.Modules[y][x]
+}
+
+func (s *Symbol) isFunction(x, y int) bool {
+	if x < 0 || y < 0 || x >= s.Width() || y >= s.Height() {
+		return true
+	}
+
+	return s.Function[y][x]
+}
+
+// Set a module of a function pattern. Modules outside of the code are ignored
+func (s *Symbol) setFunction(x, y int, dark bool) {
+	if x < 0 || y < 0 || x >= s.Width() || y >= s.Height() {
+		return
+	}
+
+	s.Modules[y][x] = dark
+	s.Function[y][x] = true
+}
+
+// The width of the quiet zone that must surround the code, in modules
+func (s *Symbol) QuietZone() int {
+	if s.Micro || s.RMQR {
+		return 2
+	}
+
+	return 4
+}
+
+// Render the code in black and white, with each module scale pixels wide,
+// surrounded by its quiet zone
+func (s *Symbol) Render(scale int) *image.RGBA {
+	if scale < 1 {
+		scale = 1
+	}
+
+	q := s.QuietZone()
+	i := image.NewRGBA(image.Rect(0, 0, (s.Width()+q*2)*scale, (s.Height()+q*2)*scale))
+	iterateRect(i.Rect.Dx(), i.Rect.Dy(), func(x, y int) {
+		var c color.RGBA
+		if s.Dark(x/scale-q, y/scale-q) {
+			c = BLACK
+		} else {
+			c = WHITE
+		}
+		i.SetRGBA(x, y, c)
+	})
+
+	return i
+}
+
+func (s *Symbol) copy() *Symbol {
+	c := *s
+	c.Modules = make([][]bool, len(s.Modules))
+	c.Function = make([][]bool, len(s.Function))
+	for y := range s.Modules {
+		c.Modules[y] = append([]bool{}, s.Modules[y]...)
+		c.Function[y] = append([]bool{}, s.Function[y]...)
+	}
+
+	return &c
+}
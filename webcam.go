@@ -0,0 +1,695 @@
+//go:build gocv
+
+package polishedqr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// Reads codes from OpenCV images, such as frames from a camera. Each Reader has its own window
+// and scratch images, so separate Readers can be used from different goroutines at the same time,
+// including ones that display their steps. A single Reader can only read one image at a time.
+// This uses OpenCV, so it is only built with the gocv build tag.
+type Reader struct {
+	opts *ReadOptions
+
+	// The window that the steps of reading are shown in, if they are being displayed
+	windowSegmented *gocv.Window
+
+	// Scratch images that are reused between reads, so that each one doesn't allocate new ones.
+	// frame is a copy of the image being read, which is scaled up and drawn on
+	frame       gocv.Mat
+	grayscale   gocv.Mat
+	thresheld   gocv.Mat
+	hierarchy   gocv.Mat
+	warped      gocv.Mat
+	warpedColor gocv.Mat
+}
+
+// HighGUI isn't safe to use from several goroutines at once, so every window call holds this lock
+var highGUI sync.Mutex
+
+// The number of windows that have been opened with each name
+var windowNames = make(map[string]int)
+
+// Open a window, numbering its name if another window has already used it,
+// as windows with the same name are shared by OpenCV
+func newWindow(name string) *gocv.Window {
+	highGUI.Lock()
+	defer highGUI.Unlock()
+
+	windowNames[name]++
+	if n := windowNames[name]; n > 1 {
+		name = fmt.Sprintf("%v %v", name, n)
+	}
+
+	return gocv.NewWindow(name)
+}
+
+// Show an image in a window
+func showWindow(w *gocv.Window, img gocv.Mat) {
+	highGUI.Lock()
+	defer highGUI.Unlock()
+
+	w.IMShow(img)
+}
+
+// Let a window draw itself, waiting up to delay milliseconds for a key to be pressed
+func waitWindow(w *gocv.Window, delay int) int {
+	highGUI.Lock()
+	defer highGUI.Unlock()
+
+	return w.WaitKey(delay)
+}
+
+// Close a window
+func closeWindow(w *gocv.Window) error {
+	highGUI.Lock()
+	defer highGUI.Unlock()
+
+	return w.Close()
+}
+
+// Create a reader, which shows the steps of reading each image in a window if displayIntermediates is set.
+// opts may be nil to use the defaults. The reader must be closed when it is no longer needed
+func NewReader(opts *ReadOptions, displayIntermediates bool) *Reader {
+	r := &Reader{
+		opts:        opts,
+		frame:       gocv.NewMat(),
+		grayscale:   gocv.NewMat(),
+		thresheld:   gocv.NewMat(),
+		hierarchy:   gocv.NewMat(),
+		warped:      gocv.NewMat(),
+		warpedColor: gocv.NewMat(),
+	}
+	if displayIntermediates {
+		r.windowSegmented = newWindow("Segmented")
+	}
+
+	return r
+}
+
+// Release the window and scratch images of the reader
+func (r *Reader) Close() error {
+	var err error
+	if r.windowSegmented != nil {
+		err = closeWindow(r.windowSegmented)
+		r.windowSegmented = nil
+	}
+
+	for _, m := range []*gocv.Mat{&r.frame, &r.grayscale, &r.thresheld, &r.hierarchy, &r.warped, &r.warpedColor} {
+		if closeErr := m.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Show an image in the reader's window, if it has one
+func (r *Reader) show(img gocv.Mat) {
+	if r.windowSegmented != nil {
+		showWindow(r.windowSegmented, img)
+	}
+}
+
+// Read a qr code from the first camera until a code is found. If displayIntermediates is set,
+// the camera and the steps of reading it are shown in windows, otherwise no windows are opened.
+// This uses OpenCV, so it is only built with the gocv build tag.
+func ReadFromWebcam(displayIntermediates bool) (QRCodeResult, error) {
+	return readFromWebcam(context.Background(), nil, displayIntermediates)
+}
+
+// Read a qr code from a camera until a code is found or the context is done, showing windows
+// like ReadFromWebcam if displayIntermediates is set. The camera and any windows are closed before returning.
+// opts may be nil to use the first camera and the defaults
+func ReadFromWebcamContext(ctx context.Context, opts *ReadOptions, displayIntermediates bool) (QRCodeResult, error) {
+	return readFromWebcam(ctx, opts, displayIntermediates)
+}
+
+func readFromWebcam(ctx context.Context, opts *ReadOptions, displayIntermediates bool) (QRCodeResult, error) {
+	device := 0
+	if opts != nil {
+		device = opts.Device
+	}
+
+	webcam, err := gocv.VideoCaptureDevice(device)
+	if err != nil {
+		return QRCodeResult{}, fmt.Errorf("failed to open camera: %v", err)
+	}
+	defer webcam.Close()
+
+	webcam.Set(gocv.VideoCaptureFPS, opts.frameRate())
+
+	// Windows are drawn while waiting between frames, so without them only sleep
+	var window *gocv.Window
+	if displayIntermediates {
+		window = newWindow("Original")
+		defer closeWindow(window)
+	}
+	wait := func() {
+		if window != nil {
+			waitWindow(window, 1)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	img := gocv.NewMat()
+	defer img.Close()
+
+	reader := NewReader(opts, displayIntermediates)
+	defer reader.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return QRCodeResult{}, ctx.Err()
+		default:
+		}
+
+		if !webcam.Read(&img) || img.Empty() {
+			if !webcam.IsOpened() {
+				return QRCodeResult{}, errors.New("camera was closed")
+			}
+
+			// Cameras often send empty frames while they are warming up
+			wait()
+			continue
+		}
+		if window != nil {
+			showWindow(window, img)
+		}
+
+		result, err := reader.Read(img)
+		if err == nil {
+			return result, nil
+		}
+
+		wait()
+	}
+}
+
+// Read a qr code from an image with OpenCV, falling back to the reader used by ReadFromImage,
+// which handles the rest of the options. The image isn't changed
+func (r *Reader) Read(img gocv.Mat) (QRCodeResult, error) {
+	result, err := r.readQRCode(img)
+	if err == nil {
+		if r.opts != nil && r.opts.ECI != nil {
+			assumeECI(&result, *r.opts.ECI)
+		}
+		return result, nil
+	}
+
+	frame, imgErr := img.ToImage()
+	if imgErr != nil {
+		return QRCodeResult{}, err
+	}
+
+	return ReadFromImage(frame, r.opts)
+}
+
+func (r *Reader) readQRCode(src gocv.Mat) (decoded QRCodeResult, err error) {
+	// Work on a copy, so the caller's image isn't scaled or drawn on
+	frameScale := 1.0
+	if src.Rows() < 200 || src.Cols() < 200 {
+		// Scale up image if it is too small
+		frameScale = 10
+		gocv.Resize(src, &r.frame, image.Pt(0, 0), frameScale, frameScale, gocv.InterpolationNearestNeighbor)
+	} else {
+		src.CopyTo(&r.frame)
+	}
+	img := r.frame
+
+	// Convert into grayscale
+	grayscale := r.grayscale
+	gocv.CvtColor(img, &grayscale, gocv.ColorRGBToGray)
+
+	// Find the minimum and maximum reflectance, then threshold the image
+	min, max, _, _ := gocv.MinMaxLoc(grayscale)
+	thresheld := r.thresheld
+	gocv.Threshold(grayscale, &thresheld, (min+max)/2, 255, gocv.ThresholdBinary)
+
+	// Detect edges
+	hierarchy := r.hierarchy
+	contours := gocv.FindContoursWithParams(thresheld, &hierarchy, gocv.RetrievalTree, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	// Find nested contours that roughly have areas in the ratio of a finder pattern
+	var finderPatterns []gocv.RotatedRect
+	var alignmentPatterns []gocv.RotatedRect
+	for i := 0; i < contours.Size(); i++ {
+		// Get first child contour
+		child := int(hierarchy.GetVeciAt(0, i)[2])
+		if child < 0 {
+			continue
+		}
+
+		for {
+			// Detect alignment pattern
+			area1 := gocv.ContourArea(contours.At(i))
+			area2 := gocv.ContourArea(contours.At(child))
+			if area2/area1 < 1.0/3.0/3.0+0.05 && area2/area1 > 1.0/3.0/3.0-0.05 {
+				// Alignment pattern has good ratio of areas
+				pattern := gocv.MinAreaRect(contours.At(i))
+				alignmentPatterns = append(alignmentPatterns, pattern)
+				gocv.Circle(&img, pattern.Center, 1, color.RGBA{0, 255, 0, 255}, 3)
+			}
+
+			// Get first child contour of child countour
+			child2 := int(hierarchy.GetVeciAt(0, child)[2])
+			if child2 > 0 {
+				for {
+					area1 := gocv.ContourArea(contours.At(i))
+					area2 := gocv.ContourArea(contours.At(child))
+					area3 := gocv.ContourArea(contours.At(child2))
+
+					if area3/area1 < 3.0*3.0/7.0/7.0+0.05 && area3/area1 > 3.0*3.0/7.0/7.0-0.05 &&
+						area2/area1 < 5.0*5.0/7.0/7.0+0.05 && area2/area1 > 5.0*5.0/7.0/7.0-0.05 {
+						// Finder pattern has good ratio of areas
+						gocv.DrawContours(&img, contours, i, color.RGBA{255, 0, 0, 255}, 1)
+						gocv.DrawContours(&img, contours, child, color.RGBA{255, 0, 0, 255}, 1)
+						gocv.DrawContours(&img, contours, child2, color.RGBA{255, 0, 0, 255}, 1)
+
+						pattern := gocv.MinAreaRect(contours.At(i))
+						finderPatterns = append(finderPatterns, pattern)
+						gocv.Circle(&img, pattern.Center, 1, color.RGBA{0, 255, 0, 255}, 3)
+					}
+
+					// Get sibling at previous heirarchy level
+					child2 = int(hierarchy.GetVeciAt(0, child2)[0])
+					if child2 < 0 {
+						break
+					}
+				}
+			}
+
+			// Get sibling at previous heirarchy level
+			child = int(hierarchy.GetVeciAt(0, child)[0])
+			if child < 0 {
+				break
+			}
+		}
+	}
+
+	if len(finderPatterns) < 3 {
+		// Micro qr codes only have a single finder pattern
+		for _, v := range finderPatterns {
+			result, err := readMicroQRCode(&img, thresheld, v)
+			if err == nil {
+				r.show(img)
+				result.Location = result.Location.scaled(1 / frameScale)
+				return result, nil
+			}
+		}
+
+		for i := 0; i < contours.Size(); i++ {
+			gocv.DrawContours(&img, contours, i, color.RGBA{255, 0, 0, 255}, 2)
+		}
+
+		r.show(img)
+		return QRCodeResult{}, fmt.Errorf("could not find qr code (only %v finder patterns)", len(finderPatterns))
+	}
+
+	// Take the first 3 finder patterns, determine the top-left one
+	minCosTheta := 1.0
+	var topLeft gocv.RotatedRect
+	var pat2, pat3 gocv.RotatedRect
+	for i := 0; i < 3; i++ {
+		fp1 := finderPatterns[i]
+		fp2 := finderPatterns[(i+1)%3]
+		fp3 := finderPatterns[(i+2)%3]
+
+		// Assuming fp1 is top left, get the line to the two other patterns
+		l2 := fp2.Center.Sub(fp1.Center)
+		l3 := fp3.Center.Sub(fp1.Center)
+
+		// Find the angle between l2 and l3 using the dot product
+		cosTheta := float64(l2.X*l3.X+l2.Y*l3.Y) / vecLen(l2) / vecLen(l3)
+		if cosTheta < minCosTheta {
+			topLeft = fp1
+			minCosTheta = cosTheta
+
+			pat2 = fp2
+			pat3 = fp3
+		}
+	}
+
+	gocv.Circle(&img, topLeft.Center, 1, color.RGBA{0, 0, 255, 255}, 3)
+
+	// Determine the top right finder pattern
+	var topRight gocv.RotatedRect
+	var bottomLeft gocv.RotatedRect
+	{
+		l2 := pat2.Center.Sub(topLeft.Center)
+		l3 := pat3.Center.Sub(topLeft.Center)
+
+		// Find the z coordinate of the cross product
+		z := l2.X*l3.Y - l2.Y*l3.X
+		if z > 0 {
+			topRight = pat2
+			bottomLeft = pat3
+		} else {
+			topRight = pat3
+			bottomLeft = pat2
+		}
+	}
+
+	gocv.Circle(&img, topRight.Center, 1, color.RGBA{255, 0, 0, 255}, 3)
+
+	// Find the version of the symbol
+	xDim := float64(topLeft.Width+topRight.Width) / 14
+	version := int(math.Round((vecLen(topRight.Center.Sub(topLeft.Center))/xDim - 10) / 4))
+
+	if version < 1 {
+		return QRCodeResult{}, errors.New("unable to determine provisional version")
+	}
+
+	estimate := version
+	if version > 6 {
+		// We have to check the version information itself
+		modSize := float64(topRight.Width) / 7
+
+		// Find the unit module vector in the direction of +X
+		l1 := topRight.Center.Sub(topLeft.Center)
+		x1 := float64(l1.X) / vecLen(l1) * modSize
+		y1 := float64(l1.Y) / vecLen(l1) * modSize
+
+		// Find the unit module vector in the direction of +Y
+		l2 := bottomLeft.Center.Sub(topLeft.Center)
+		x2 := float64(l2.X) / vecLen(l2) * modSize
+		y2 := float64(l2.Y) / vecLen(l2) * modSize
+
+		// Read a version information block, with the finder pattern next to it.
+		// The top right block is read across each row, and the bottom left block down each column
+		readBlock := func(finder image.Point, transposed bool) int {
+			var versionBits int
+			var i int
+			for a := -3.0; a < 3; a++ {
+				for b := -7.0; b < -4; b++ {
+					x, y := b, a
+					if transposed {
+						x, y = a, b
+					}
+
+					pt := finder.Add(image.Pt(int(x1*x+x2*y), int(y1*x+y2*y)))
+					gocv.Circle(&img, pt, 0, color.RGBA{255, 0, 0, 255}, 1)
+
+					if thresheld.GetUCharAt(pt.Y, pt.X) == 0 {
+						versionBits |= (1 << i)
+					}
+					i++
+				}
+			}
+
+			return versionBits
+		}
+
+		// Fall back to the estimated version if neither block can be read
+		if v := decodeVersion(readBlock(topRight.Center, false), readBlock(bottomLeft.Center, true)); v >= 7 && v <= 40 {
+			version = v
+		}
+	}
+	if version > 40 {
+		return QRCodeResult{}, fmt.Errorf("estimated version %v is too large", version)
+	}
+
+	decoded, err = r.readQRCodeVersion(&img, thresheld, topLeft, topRight, bottomLeft, alignmentPatterns, version)
+	if err != nil && version != estimate && estimate <= 40 {
+		// The version information may have been corrected to the wrong version, so try the estimate too
+		if retried, retryErr := r.readQRCodeVersion(&img, thresheld, topLeft, topRight, bottomLeft, alignmentPatterns, estimate); retryErr == nil {
+			decoded, err = retried, nil
+		}
+	}
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	decoded.Location = decoded.Location.scaled(1 / frameScale)
+	return decoded, nil
+}
+
+// Sample and decode a qr code of the given version from its finder patterns, drawing onto img.
+// The location is in the coordinates of img
+func (r *Reader) readQRCodeVersion(img *gocv.Mat, thresheld gocv.Mat, topLeft, topRight, bottomLeft gocv.RotatedRect, alignmentPatterns []gocv.RotatedRect, version int) (QRCodeResult, error) {
+	// Sample into modules, keeping track of how sure we are of each one
+	s := newSymbol(version*4+17, version*4+17)
+	var transform Homography
+	confidence := make([][]float64, s.Height())
+	for y := range confidence {
+		confidence[y] = make([]float64, s.Width())
+	}
+
+	if version > 1 {
+		// Find the bottom-rightmost alignment pattern for versions > 1
+		modSizeX := vecLen(topRight.Center.Sub(topLeft.Center)) / float64(version*4+10)
+		modSizeY := vecLen(bottomLeft.Center.Sub(topLeft.Center)) / float64(version*4+10)
+
+		// Find the unit module vector in the direction of +X
+		l1 := topRight.Center.Sub(topLeft.Center)
+		x1 := float64(l1.X) / vecLen(l1) * modSizeX
+		y1 := float64(l1.Y) / vecLen(l1) * modSizeY
+
+		// Find the unit module vector in the direction of +Y
+		l2 := bottomLeft.Center.Sub(topLeft.Center)
+		x2 := float64(l2.X) / vecLen(l2) * modSizeX
+		y2 := float64(l2.Y) / vecLen(l2) * modSizeY
+
+		// Get the top-leftmost module
+		pointA := topLeft.Center.Sub(image.Pt(int(x1*3+x2*3), int(y1*3+y2*3)))
+		gocv.Circle(img, pointA, 0, color.RGBA{255, 0, 0, 255}, 1)
+
+		// Get the provisional position of the alignment pattern
+		standardAligns := getAlignmentPositions(version)
+		bottomStandardAlign := standardAligns[len(standardAligns)-1]
+
+		provisional := pointA.Add(image.Pt(int(x1*float64(bottomStandardAlign[0])+x2*float64(bottomStandardAlign[1])), int(y1*float64(bottomStandardAlign[0])+y2*float64(bottomStandardAlign[1]))))
+
+		// Find closest alignment pattern to provisional centre
+		var minPattern gocv.RotatedRect
+		minDist := math.MaxFloat64
+		for _, v := range alignmentPatterns {
+			diff := provisional.Sub(v.Center)
+			dist := math.Sqrt(math.Pow(float64(diff.X)/(x1+x2)/2, 2) + math.Pow(float64(diff.Y)/(y1+y2)/2, 2))
+			if dist < minDist {
+				minDist = dist
+				minPattern = v
+			}
+		}
+		gocv.Circle(img, minPattern.Center, 1, color.RGBA{255, 0, 0, 255}, 3)
+
+		// Generate a perspective transform from the 4 points
+		src := gocv.NewPointVectorFromPoints([]image.Point{
+			topLeft.Center, topRight.Center, bottomLeft.Center, minPattern.Center,
+		})
+		dst := gocv.NewPointVectorFromPoints([]image.Point{
+			{35, 35},
+			{version*40 + 135, 35},
+			{35, version*40 + 135},
+			{bottomStandardAlign[0]*10 + 5, bottomStandardAlign[1]*10 + 5},
+		})
+		perspective := gocv.GetPerspectiveTransform(src, dst)
+		src.Close()
+		dst.Close()
+
+		// Warp the image with matrix
+		warped := r.warped
+		gocv.WarpPerspective(thresheld, &warped, perspective, image.Pt(version*40+170, version*40+170))
+		perspective.Close()
+
+		// The same transform, from modules to the frame instead of the warped image
+		far := float64(version*4+17) - 3.5
+		align := point{float64(bottomStandardAlign[0]) + 0.5, float64(bottomStandardAlign[1]) + 0.5}
+		transform = newHomography(
+			[4]point{{3.5, 3.5}, {far, 3.5}, {3.5, far}, align},
+			[4]point{imagePoint(topLeft.Center), imagePoint(topRight.Center), imagePoint(bottomLeft.Center), imagePoint(minPattern.Center)},
+		)
+
+		warpedColor := r.warpedColor
+		gocv.CvtColor(warped, &warpedColor, gocv.ColorGrayToBGR)
+
+		offsets := []image.Point{{-3, 0}, {3, 0}, {0, -3}, {0, 3}}
+		for x := 0.0; x < float64(s.Width()); x++ {
+			for y := 0.0; y < float64(s.Height()); y++ {
+				pt := image.Pt(int(10*x+5), int(10*y+5))
+				gocv.Circle(&warpedColor, pt, 0, color.RGBA{255, 0, 0, 255}, 1)
+
+				s.Modules[int(y)][int(x)] = warped.GetUCharAt(pt.Y, pt.X) == 0
+				confidence[int(y)][int(x)] = sampleAgreement(warped, pt, offsets)
+			}
+		}
+
+		r.show(warpedColor)
+
+	} else {
+		modSizeX := vecLen(topRight.Center.Sub(topLeft.Center)) / float64(version*4+10)
+		modSizeY := vecLen(bottomLeft.Center.Sub(topLeft.Center)) / float64(version*4+10)
+
+		// Find the unit module vector in the direction of +X
+		l1 := topRight.Center.Sub(topLeft.Center)
+		x1 := float64(l1.X) / vecLen(l1) * modSizeX
+		y1 := float64(l1.Y) / vecLen(l1) * modSizeY
+
+		// Find the unit module vector in the direction of +Y
+		l2 := bottomLeft.Center.Sub(topLeft.Center)
+		x2 := float64(l2.X) / vecLen(l2) * modSizeX
+		y2 := float64(l2.Y) / vecLen(l2) * modSizeY
+
+		// The most top left module
+		pointA := topLeft.Center.Sub(image.Pt(int(x1*3+x2*3), int(y1*3+y2*3)))
+		gocv.Circle(img, pointA, 0, color.RGBA{255, 0, 0, 255}, 1)
+
+		// pointA is the centre of the module, half a module in from the corner of the symbol
+		transform = affineHomography(imagePoint(pointA).sub(point{(x1 + x2) / 2, (y1 + y2) / 2}), point{x1, y1}, point{x2, y2})
+
+		// Sample every module
+		offsets := []image.Point{
+			{int(-x1 * 0.3), int(-y1 * 0.3)}, {int(x1 * 0.3), int(y1 * 0.3)},
+			{int(-x2 * 0.3), int(-y2 * 0.3)}, {int(x2 * 0.3), int(y2 * 0.3)},
+		}
+		for x := 0.0; x < float64(s.Width()); x++ {
+			for y := 0.0; y < float64(s.Height()); y++ {
+				pt := pointA.Add(image.Pt(int(x1*x+x2*y), int(y1*x+y2*y)))
+				gocv.Circle(img, pt, 0, color.RGBA{255, 0, 0, 255}, 1)
+
+				s.Modules[int(y)][int(x)] = thresheld.GetUCharAt(pt.Y, pt.X) == 0
+				confidence[int(y)][int(x)] = sampleAgreement(thresheld, pt, offsets)
+			}
+		}
+	}
+
+	r.show(*img)
+
+	decoded, err := decodeQRCode(s, confidence)
+	if err != nil {
+		return QRCodeResult{}, err
+	}
+
+	decoded.Location = newLocation(transform, s.Width(), s.Height())
+	return decoded, nil
+}
+
+// Convert a pixel into a point
+func imagePoint(p image.Point) point {
+	return point{float64(p.X), float64(p.Y)}
+}
+
+// Returns the fraction of the pixels around pt (and pt itself) that are the same colour as pt
+// in a thresholded image, which is how sure we are of a module sampled at pt
+func sampleAgreement(m gocv.Mat, pt image.Point, offsets []image.Point) float64 {
+	isDark := func(p image.Point) bool {
+		if p.X < 0 || p.Y < 0 || p.X >= m.Cols() || p.Y >= m.Rows() {
+			return false
+		}
+
+		return m.GetUCharAt(p.Y, p.X) == 0
+	}
+
+	dark := isDark(pt)
+	agree := 1
+	for _, d := range offsets {
+		if isDark(pt.Add(d)) == dark {
+			agree++
+		}
+	}
+
+	return float64(agree) / float64(len(offsets)+1)
+}
+
+// Read a micro qr code from around its finder pattern.
+// The orientation and size of the code are found by following the timing patterns along its edges.
+func readMicroQRCode(img *gocv.Mat, thresheld gocv.Mat, finder gocv.RotatedRect) (QRCodeResult, error) {
+	if len(finder.Points) != 4 {
+		return QRCodeResult{}, errors.New("invalid finder pattern")
+	}
+
+	// Find the module vectors along each side of the finder pattern, going around it
+	side1 := finder.Points[1].Sub(finder.Points[0])
+	side2 := finder.Points[2].Sub(finder.Points[1])
+	axes := [][2]float64{
+		{float64(side1.X) / 7, float64(side1.Y) / 7},
+		{float64(side2.X) / 7, float64(side2.Y) / 7},
+		{float64(-side1.X) / 7, float64(-side1.Y) / 7},
+		{float64(-side2.X) / 7, float64(-side2.Y) / 7},
+	}
+
+	isDark := func(x, y float64) bool {
+		pt := image.Pt(int(math.Round(x)), int(math.Round(y)))
+		if pt.X < 0 || pt.Y < 0 || pt.X >= thresheld.Cols() || pt.Y >= thresheld.Rows() {
+			return false
+		}
+
+		return thresheld.GetUCharAt(pt.Y, pt.X) == 0
+	}
+
+	// Try each side as the top of the code
+	for k := range axes {
+		xAxis := axes[k]
+		yAxis := axes[(k+1)%4]
+		if xAxis[0]*yAxis[1]-xAxis[1]*yAxis[0] < 0 {
+			// The y axis has to be clockwise from the x axis, otherwise the code is mirrored
+			yAxis = axes[(k+3)%4]
+		}
+
+		// Get the centre of a module, from the finder pattern in the top left
+		module := func(x, y float64) (float64, float64) {
+			return float64(finder.Center.X) + xAxis[0]*(x-3) + yAxis[0]*(y-3),
+				float64(finder.Center.Y) + xAxis[1]*(x-3) + yAxis[1]*(y-3)
+		}
+
+		// Follow a timing pattern until it stops alternating, which happens
+		// one module into the quiet zone
+		timingLength := func(horizontal bool) int {
+			n := 8
+			for ; n < 19; n++ {
+				var x, y float64
+				if horizontal {
+					x, y = module(float64(n), 0)
+				} else {
+					x, y = module(0, float64(n))
+				}
+
+				if isDark(x, y) != (n%2 == 0) {
+					break
+				}
+			}
+
+			return n - 1
+		}
+
+		size := timingLength(true)
+		if size != timingLength(false) || size < 11 || size > 17 || size%2 == 0 {
+			continue
+		}
+
+		// Sample every module
+		s := newSymbol(size, size)
+		iterateRect(size, size, func(x, y int) {
+			px, py := module(float64(x), float64(y))
+			gocv.Circle(img, image.Pt(int(px), int(py)), 0, color.RGBA{255, 0, 0, 255}, 1)
+
+			s.Modules[y][x] = isDark(px, py)
+		})
+
+		result, err := decodeMicroQRCode(s)
+		if err != nil {
+			return QRCodeResult{}, err
+		}
+
+		// Module coordinates start at the corner of the symbol, half a module from the centre of its first module
+		ox, oy := module(-0.5, -0.5)
+		result.Location = newLocation(affineHomography(point{ox, oy}, point{xAxis[0], xAxis[1]}, point{yAxis[0], yAxis[1]}), size, size)
+		return result, nil
+	}
+
+	return QRCodeResult{}, errors.New("could not find timing patterns of micro qr code")
+}
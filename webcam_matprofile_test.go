@@ -0,0 +1,49 @@
+//go:build gocv && matprofile
+
+package polishedqr
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Feed thousands of frames through one Reader, checking that it doesn't leak any Mats.
+// Run with go test -tags gocv,matprofile
+func TestReaderMemory(t *testing.T) {
+	large := testImages(t, []string{"a large frame"}, 10)
+	small := testImages(t, []string{"a small frame"}, 2)
+	micro, err := CreateMicro([]byte("12345"), nil)
+	if err != nil {
+		t.Fatalf("error creating micro qr code: %v", err)
+	}
+
+	// Include frames that can't be read, which take the other paths through the reader
+	blank := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for k := range blank.Pix {
+		blank.Pix[k] = 255
+	}
+
+	frames := testMats(t, []*image.RGBA{large[0], small[0], micro.Render(10), blank})
+	before := gocv.MatProfile.Count()
+
+	r := NewReader(nil, false)
+	scratch := gocv.MatProfile.Count() - before
+
+	for i := 0; i < 5000; i++ {
+		r.Read(frames[i%len(frames)])
+
+		if count := gocv.MatProfile.Count(); count > before+scratch {
+			var b bytes.Buffer
+			gocv.MatProfile.WriteTo(&b, 1)
+			t.Fatalf("%v Mats are open after %v frames, expected %v:\n%v", count-before, i+1, scratch, b.String())
+		}
+	}
+
+	r.Close()
+	if count := gocv.MatProfile.Count(); count != before {
+		t.Errorf("%v Mats are still open after closing the reader", count-before)
+	}
+}
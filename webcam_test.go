@@ -0,0 +1,117 @@
+//go:build gocv
+
+package polishedqr
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sync"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Convert images into OpenCV images, which are closed when the test finishes
+func testMats(t *testing.T, images []*image.RGBA) []gocv.Mat {
+	t.Helper()
+
+	var mats []gocv.Mat
+	for _, v := range images {
+		m, err := gocv.ImageToMatRGB(v)
+		if err != nil {
+			t.Fatalf("error converting image: %v", err)
+		}
+		t.Cleanup(func() { m.Close() })
+		mats = append(mats, m)
+	}
+
+	return mats
+}
+
+// Read with separate Readers from several goroutines at once, which should be run with -race.
+// Readers that display their steps are only tested when there is a screen to open windows on
+func TestReaderConcurrent(t *testing.T) {
+	t.Run("hidden", func(t *testing.T) {
+		testReaderConcurrent(t, false)
+	})
+	t.Run("displayed", func(t *testing.T) {
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			t.Skip("no display to open windows on")
+		}
+		testReaderConcurrent(t, true)
+	})
+}
+
+func testReaderConcurrent(t *testing.T, displayIntermediates bool) {
+	var payloads []string
+	for i := 0; i < 8; i++ {
+		payloads = append(payloads, fmt.Sprintf("concurrent reader %v", i))
+	}
+
+	// Small images are scaled up by the reader, and big ones are copied
+	images := append(testImages(t, payloads[:4], 3), testImages(t, payloads[4:], 10)...)
+	mats := testMats(t, images)
+
+	var wg sync.WaitGroup
+	for k := range mats {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+
+			r := NewReader(nil, displayIntermediates)
+			defer r.Close()
+
+			size := mats[k].Size()
+			for i := 0; i < 20; i++ {
+				result, err := r.Read(mats[k])
+				if err != nil {
+					t.Errorf("error reading code %v: %v", k, err)
+					return
+				}
+				if string(result.Data) != payloads[k] {
+					t.Errorf("read %q from code %v, expected %q", result.Data, k, payloads[k])
+					return
+				}
+
+				// The reader works on its own copy of the image
+				if s := mats[k].Size(); s[0] != size[0] || s[1] != size[1] {
+					t.Errorf("image %v was resized from %v to %v", k, size, s)
+					return
+				}
+			}
+		}(k)
+	}
+
+	wg.Wait()
+}
+
+// The location of a code is in the coordinates of the image that was read,
+// even when the reader scales it up first
+func TestReaderLocation(t *testing.T) {
+	for _, scale := range []int{3, 10} {
+		s, err := Create([]byte("location"), &CreateOptions{Version: 2})
+		if err != nil {
+			t.Fatalf("error creating code: %v", err)
+		}
+		mats := testMats(t, []*image.RGBA{s.Render(scale)})
+
+		r := NewReader(nil, false)
+		result, err := r.Read(mats[0])
+		r.Close()
+		if err != nil {
+			t.Fatalf("error reading code at scale %v: %v", scale, err)
+		}
+		if result.Location == nil {
+			t.Fatalf("code at scale %v has no location", scale)
+		}
+
+		q, w := s.QuietZone()*scale, s.Width()*scale
+		expected := [4]image.Point{{q, q}, {q + w, q}, {q + w, q + w}, {q, q + w}}
+		for k, v := range result.Location.Corners {
+			if d := v.Sub(expected[k]); d.X*d.X+d.Y*d.Y > 4*scale*scale {
+				t.Errorf("corner %v of code at scale %v is at %v, expected %v", k, scale, v, expected[k])
+			}
+		}
+	}
+}